@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
@@ -12,6 +17,7 @@ import (
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/fsnotify/fsnotify"
 	"github.com/goburrow/serial"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -19,6 +25,7 @@ import (
 	"github.com/marevers/energia/pkg/axpert"
 	"github.com/marevers/energia/pkg/connector"
 	"github.com/marevers/energia/pkg/pylontech"
+	"github.com/marevers/energia/pkg/pylontech/can"
 )
 
 var timerInterval int
@@ -30,12 +37,60 @@ var mqttUsername string
 var mqttPassword string
 
 var inverterPath string
+var inverterRecord string
+var inverterBaud int
 var inverterCount int
 var inverterTopic string
+var inverterProtocolName string
+
+// Protocol of the inverter, detected at startup unless configured
+var inverterProtocol = axpert.PI30
+
+// Whether the inverter answers QPIGS2 with the status of the second tracker,
+// only used while holding the inverter connector
+var inverterStatus2 bool
 
 var batteryPath string
+var batteryRecord string
 var batteryBaud int
 var batteryTopic string
+var batteryAllowTurnOff bool
+var batteryCAN string
+var batterySniff bool
+var batteryAddresses []byte
+var batteryScanLast int
+var batteryScanTimeout time.Duration
+
+// Serial numbers of the packs whose identity has been published, only used
+// while holding the battery connector
+var packIdentities = make(map[string]bool)
+
+// Serial numbers of the packs of each battery group by position, empty for
+// packs that cannot report one. Read on the first poll and again after a
+// reconnect or when the pack count changes, only used while holding the
+// battery connector.
+var packSerials = make(map[byte][]string)
+
+// Last fault code of each inverter, only used while holding the inverter
+// connector
+var inverterFaults = make(map[int]axpert.FaultCode)
+
+// Inverters that do not answer QP2GS by index, only used while holding the
+// inverter connector
+var parallelPVUnsupported = make(map[int]bool)
+
+// Consecutive QP2GS timeouts of each inverter, only used while holding the
+// inverter connector
+var parallelPVTimeouts = make(map[int]int)
+
+var reconnectConfig connector.ReconnectConfig
+
+var logLevel string
+var logFormat string
+
+var traceEnabled bool
+var traceOutput string
+var tracers []*connector.TraceConnector
 
 type messageData struct {
 	Timestamp   time.Time
@@ -43,7 +98,29 @@ type messageData struct {
 	Data        interface{}
 }
 
-type queryFunc func(chan connector.Connector, mqtt.Client, time.Time) error
+// Status of a single pack, the address of its battery group and its
+// position in the group
+type packStatus struct {
+	Address  byte
+	Position int
+	pylontech.BatteryStatus
+}
+
+// Decoded fault code of an inverter
+type inverterFault struct {
+	Inverter    int
+	Code        axpert.FaultCode
+	Description string
+	Severity    axpert.FaultSeverity
+}
+
+// Change of the fault code of an inverter from Previous to Code
+type faultTransition struct {
+	inverterFault
+	Previous axpert.FaultCode
+}
+
+type queryFunc func(context.Context, chan connector.Connector, mqtt.Client, time.Time) error
 
 type query struct {
 	f        queryFunc
@@ -53,17 +130,43 @@ type query struct {
 
 var ucc chan connector.Connector
 
+// Upper bound for handling a command received over MQTT
+const commandTimeout = 30 * time.Second
+
 func main() {
-	fmt.Println("initializing config ")
+	// Cancelled on shutdown, which also cancels any request in flight
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	err := initConfig()
-	fmt.Println("initialized config ", viper.AllSettings())
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Println("connecting to ", inverterPath)
-	uc, err := connector.NewUSBConnector(inverterPath)
+	logger, err := newLogger(logLevel, logFormat)
+	if err != nil {
+		panic(err)
+	}
+	slog.SetDefault(logger)
+	axpert.SetLogger(logger)
+	pylontech.SetLogger(logger)
+	slog.Debug("initialized config", "settings", redactSettings(viper.AllSettings()))
+
+	sink, err := traceSink(traceOutput)
+	if err != nil {
+		panic(err)
+	}
+
+	slog.Info("connecting to inverter", "path", inverterPath)
+	uc, err := newConnector(inverterPath, inverterBaud, func() (connector.Connector, error) {
+		return connector.NewUSBConnector(inverterPath)
+	})
+	if err != nil {
+		panic(err)
+	}
+	uc = traceConnector(uc, sink, axpert.DescribeFrame)
+	urc := connector.NewReconnectConnector(uc, reconnectConfig)
+	uc, err = recordConnector(urc, inverterRecord)
 	if err != nil {
 		panic(err)
 	}
@@ -73,35 +176,70 @@ func main() {
 	}
 	defer uc.Close()
 
+	slog.Info("connected to inverter", "path", inverterPath)
+
+	inverterProtocol = detectProtocol(ctx, uc)
+	slog.Info("inverter protocol", "protocol", inverterProtocol.Name())
+	inverterStatus2 = detectStatus2(ctx, uc)
+
 	ucc = make(chan connector.Connector, 1)
 	ucc <- uc
-	fmt.Println("connected to ", inverterPath)
 
 	var sc connector.Connector
+	var src *connector.ReconnectConnector
 	var scc chan connector.Connector
 
 	if viper.IsSet("battery.path") {
 
-		serialConfig := serial.Config{
-			Address:  batteryPath,
-			BaudRate: batteryBaud,
-			DataBits: 8,
-			StopBits: 1,
-			Parity:   "N",
-			Timeout:  30 * time.Second,
+		sc, err = newConnector(batteryPath, batteryBaud, func() (connector.Connector, error) {
+			serialConfig := serial.Config{
+				Address:  batteryPath,
+				BaudRate: batteryBaud,
+				DataBits: 8,
+				StopBits: 1,
+				Parity:   "N",
+				Timeout:  30 * time.Second,
+			}
+			return connector.NewSerialConnector(serialConfig), nil
+		})
+		if err != nil {
+			log.Panic(err)
+		}
+		sc = traceConnector(sc, sink, pylontech.DescribeFrame)
+		src = connector.NewReconnectConnector(sc, reconnectConfig)
+		sc, err = recordConnector(src, batteryRecord)
+		if err != nil {
+			log.Panic(err)
 		}
-
-		sc = connector.NewSerialConnector(serialConfig)
 		err = sc.Open()
 		if err != nil {
 			log.Panic(err)
 		}
 		defer sc.Close()
 
-		scc = make(chan connector.Connector, 1)
-		scc <- sc
+		if !batterySniff {
+			if len(batteryAddresses) == 0 {
+				batteryAddresses = scanBattery(ctx, src.Connector())
+			}
+			slog.Info("polling battery groups", "addresses", batteryAddresses)
+
+			scc = make(chan connector.Connector, 1)
+			scc <- sc
+		}
 	}
 
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		enabled := viper.GetBool("trace.enabled")
+		if enabled != traceEnabled {
+			slog.Info("tracing changed", "enabled", enabled)
+			traceEnabled = enabled
+			for _, tc := range tracers {
+				tc.SetEnabled(enabled)
+			}
+		}
+	})
+	viper.WatchConfig()
+
 	clientOpts := mqtt.NewClientOptions()
 	clientOpts.AddBroker("tcp://" + mqttServer + ":" + strconv.Itoa(mqttPort))
 	clientOpts.SetAutoReconnect(true)
@@ -118,8 +256,157 @@ func main() {
 		panic(token.Error())
 	}
 	defer client.Disconnect(250)
-	fmt.Println("Connected to mqtt")
+	slog.Info("connected to mqtt", "server", mqttServer, "port", mqttPort)
+
+	reportConnectionState(urc, inverterTopic+"/Connection", client, nil)
+	if src != nil {
+		// Packs may have been swapped while disconnected
+		reportConnectionState(src, batteryTopic+"/Connection", client, func() { clear(packSerials) })
+	}
+
+	queries := pollQueries(ucc, scc)
+
+	if batteryCAN != "" {
+		slog.Info("listening for battery on CAN", "interface", batteryCAN)
+		socket, err := can.OpenSocket(batteryCAN)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer socket.Close()
+
+		listener := can.NewListener(socket)
+		go func() {
+			err := listener.Run(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.Error("battery CAN listener failed", "error", err)
+			}
+		}()
+		queries = append(queries, query{canStatus(listener), nil, 10 * time.Second})
+	}
+
+	if sc != nil && batterySniff {
+		slog.Info("sniffing battery traffic", "path", batteryPath)
+		go sniff(ctx, sc, src, func(ev *pylontech.SnifferEvent) {
+			msgData := messageData{Timestamp: ev.Time, MessageType: "Sniffer", Data: newSniffedFrame(ev)}
+			err := sendMessage(msgData, batteryTopic+"/"+msgData.MessageType, client)
+			if err != nil {
+				slog.Warn("publishing sniffed frame failed", "error", err)
+			}
+		})
+	}
+
+	ts := make([]*time.Ticker, len(queries))
+
+	for i, q := range queries {
+		ts[i] = schedule(ctx, q.f, q.interval, q.cc, client)
+	}
+
+	client.Subscribe("inverter/cmd/setOutputSourcePriority", 1, messageReceiver)
+	if scc != nil && batteryAllowTurnOff {
+		slog.Warn("battery turn off enabled")
+		client.Subscribe("battery/cmd/turnOff", 1, turnOffReceiver(scc))
+	}
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down, stopping tickers")
+
+	for _, t := range ts {
+		t.Stop()
+	}
+
+	slog.Info("exiting")
+}
+
+type connectionState struct {
+	State string
+	Error string `json:",omitempty"`
+}
+
+// Publishes the current connection state of rc to topic, and every change
+// from now on. onConnect, if not nil, is called on every reconnect.
+func reportConnectionState(rc *connector.ReconnectConnector, topic string, client mqtt.Client, onConnect func()) {
+	publish := func(state connector.State, err error) {
+		if state == connector.StateConnected && onConnect != nil {
+			onConnect()
+		}
+
+		cs := connectionState{State: state.String()}
+		if err != nil {
+			cs.Error = err.Error()
+		}
+		slog.Info("connection state changed", "topic", topic, "state", cs.State, "error", cs.Error)
+
+		msgData := messageData{Timestamp: time.Now(), MessageType: "Connection", Data: cs}
+		err = sendMessage(msgData, topic, client)
+		if err != nil {
+			slog.Warn("failed sending connection state", "error", err)
+		}
+	}
+
+	rc.OnStateChange(publish)
+	publish(rc.State())
+}
+
+// Returns the configured inverter protocol, or the detected one for auto.
+// Falls back to PI30 if detection fails.
+func detectProtocol(ctx context.Context, c connector.Connector) axpert.Protocol {
+	switch strings.ToUpper(inverterProtocolName) {
+	case "PI30":
+		return axpert.PI30
+	case "PI18":
+		return axpert.PI18
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	p, err := axpert.DetectProtocolContext(dctx, c)
+	if err != nil {
+		slog.Warn("inverter protocol detection failed, assuming PI30", "error", err)
+		return axpert.PI30
+	}
+	return p
+}
+
+// Returns whether the inverter answers QPIGS2. Only PI30 has it, PI18
+// reports the second tracker in its general status.
+func detectStatus2(ctx context.Context, c connector.Connector) bool {
+	if inverterProtocol != axpert.PI30 {
+		return false
+	}
 
+	dctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	_, err := axpert.DeviceGeneralStatus2Context(dctx, c, &axpert.DeviceStatusParams{})
+	switch {
+	case err == nil:
+		slog.Info("inverter reports second tracker status")
+		return true
+	case unsupported(err):
+		slog.Info("inverter does not report second tracker status")
+	default:
+		slog.Warn("second tracker status detection failed", "error", err)
+	}
+	return false
+}
+
+// Returns the addresses of the battery groups on the bus, scanned on the
+// connector below the reconnect wrapper so that absent addresses do not count
+// as timeouts. Falls back to the first group if none answers.
+func scanBattery(ctx context.Context, c connector.Connector) []byte {
+	addresses, err := pylontech.ScanContext(ctx, c, 1, byte(batteryScanLast), batteryScanTimeout)
+	if err != nil {
+		slog.Warn("battery scan failed", "error", err)
+	}
+	if len(addresses) == 0 {
+		return []byte{1}
+	}
+	return addresses
+}
+
+// Returns the queries polled from the inverter, and from every battery group
+// if scc is set.
+func pollQueries(ucc chan connector.Connector, scc chan connector.Connector) []query {
 	queries := []query{
 		{deviceMode, ucc, 30 * time.Second},
 		{parallelDeviceInfo, ucc, 30 * time.Second},
@@ -129,51 +416,171 @@ func main() {
 		{deviceRating, ucc, 30 * time.Second},
 	}
 
-	if viper.IsSet("battery.path") {
-		queries = append(queries, query{batteryStatus, scc, 10 * time.Second})
+	if scc != nil {
+		for _, address := range batteryAddresses {
+			queries = append(queries, query{batteryStatus(address), scc, 10 * time.Second})
+			queries = append(queries, query{alarmInfo(address), scc, 10 * time.Second})
+		}
 	}
 
-	ts := make([]*time.Ticker, len(queries))
+	return queries
+}
 
-	for i, q := range queries {
-		ts[i] = schedule(q.f, q.interval, q.cc, client)
+// Returns a TCP connector when path is a tcp:// (raw socket) or rfc2217:// URL
+// of a serial-over-IP gateway, a replay connector for a replay:// URL pointing
+// to a recorded session, otherwise the connector created by local.
+func newConnector(path string, baud int, local func() (connector.Connector, error)) (connector.Connector, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return local()
 	}
 
-	client.Subscribe("inverter/cmd/setOutputSourcePriority", 1, messageReceiver)
+	switch u.Scheme {
+	case "tcp":
+		return connector.NewTCPConnector(connector.TCPConfig{
+			Address: u.Host,
+			Timeout: 30 * time.Second,
+		}), nil
+	case "rfc2217":
+		return connector.NewTCPConnector(connector.TCPConfig{
+			Address:  u.Host,
+			RFC2217:  true,
+			BaudRate: baud,
+			DataBits: 8,
+			StopBits: 1,
+			Parity:   "N",
+			Timeout:  30 * time.Second,
+		}), nil
+	case "replay":
+		return connector.NewReplayConnector(strings.TrimPrefix(path, "replay://"))
+	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-sigChan
-	close(sigChan)
-	fmt.Println(sig, " stopping tickers")
+	return local()
+}
 
-	for _, t := range ts {
-		t.Stop()
+// Wraps c in a connector recording the session to path, if set.
+func recordConnector(c connector.Connector, path string) (connector.Connector, error) {
+	if path == "" {
+		return c, nil
 	}
+	return connector.NewRecordConnector(c, path)
+}
 
-	fmt.Println("exiting")
+// Wraps c in a connector tracing all traffic to sink, enabled or disabled at
+// runtime through trace.enabled in the config file.
+func traceConnector(c connector.Connector, sink connector.TraceSink, decode connector.FrameDecoder) connector.Connector {
+	tc := connector.NewTraceConnector(c, sink, decode)
+	tc.SetEnabled(traceEnabled)
+	tracers = append(tracers, tc)
+	return tc
+}
+
+// Returns a sink writing to stderr, or appending to the file at path if set.
+func traceSink(path string) (connector.TraceSink, error) {
+	var w io.Writer = os.Stderr
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return connector.NewWriterSink(w), nil
 }
 
-func schedule(f queryFunc, interval time.Duration, ucc chan connector.Connector, client mqtt.Client) *time.Ticker {
+// Runs in a row answered with NAK before a query is disabled, a single NAK
+// may be the answer to a garbled request
+const maxUnsupported = 3
+
+// Runs f every interval, each run is bounded by the interval so a stuck
+// request cannot hold the connector for longer than one poll cycle.
+func schedule(ctx context.Context, f queryFunc, interval time.Duration, ucc chan connector.Connector, client mqtt.Client) *time.Ticker {
 	ticker := time.NewTicker(interval)
 	go func() {
+		naks := 0
 		for t := range ticker.C {
-			f(ucc, client, t)
+			qctx, cancel := context.WithTimeout(ctx, interval)
+			err := f(qctx, ucc, client, t)
+			if err != nil && retryable(err) && qctx.Err() == nil {
+				err = f(qctx, ucc, client, t)
+			}
+			cancel()
+
+			if unsupported(err) {
+				naks++
+			} else {
+				naks = 0
+			}
+
+			switch {
+			case err == nil:
+			case naks >= maxUnsupported:
+				slog.Warn("query not supported by device, disabling", "error", err)
+				ticker.Stop()
+				return
+			case naks > 0:
+				slog.Warn("query not acknowledged", "error", err)
+			case errors.Is(err, connector.ErrDisconnected):
+				// Reconnected by the ReconnectConnector on a later run
+			default:
+				slog.Error("query failed", "error", err)
+			}
 		}
 	}()
 	return ticker
 }
 
-func deviceGeneralStatus(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+// Corrupted responses, e.g. from line noise, are retried right away. Timeouts
+// are not, the device is given until the next run and reopened by the
+// ReconnectConnector when it keeps timing out.
+func retryable(err error) bool {
+	return errors.Is(err, axpert.ErrChecksum) || errors.Is(err, axpert.ErrFraming) ||
+		errors.Is(err, pylontech.ErrChecksum) || errors.Is(err, pylontech.ErrFraming)
+}
+
+// Queries the device does not implement are not worth repeating.
+func unsupported(err error) bool {
+	return errors.Is(err, axpert.ErrNotSupported) || errors.Is(err, pylontech.ErrNotSupported)
+}
+
+// Takes the connector from cc, waiting at most until ctx is done. The
+// connector must be handed back to cc when done.
+func acquire(ctx context.Context, cc chan connector.Connector) (connector.Connector, error) {
+	select {
+	case c := <-cc:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func deviceGeneralStatus(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
 
-	uc := <-ucc
+	uc, err := acquire(ctx, ucc)
+	if err != nil {
+		return err
+	}
 
 	defer func() { ucc <- uc }()
 
-	status, err := axpert.DeviceGeneralStatus(uc)
+	status, err := inverterProtocol.DeviceGeneralStatus(ctx, uc)
 	if err != nil {
 		return err
 	}
+
+	if inverterStatus2 {
+		_, err = axpert.DeviceGeneralStatus2Context(ctx, uc, status)
+		// The status of the first tracker is still published
+		if unsupported(err) {
+			slog.Warn("second tracker status no longer supported", "error", err)
+			inverterStatus2 = false
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	msgData := messageData{Timestamp: t, MessageType: "Status", Data: status}
 	err = sendInverterMessage(msgData, client)
 	if err != nil {
@@ -184,13 +591,16 @@ func deviceGeneralStatus(ucc chan connector.Connector, client mqtt.Client, t tim
 
 }
 
-func warningStatus(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+func warningStatus(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
 
-	uc := <-ucc
+	uc, err := acquire(ctx, ucc)
+	if err != nil {
+		return err
+	}
 
 	defer func() { ucc <- uc }()
 
-	warnings, err := axpert.WarningStatus(uc)
+	warnings, err := inverterProtocol.WarningStatus(ctx, uc)
 	if err != nil {
 		return err
 	}
@@ -203,13 +613,19 @@ func warningStatus(ucc chan connector.Connector, client mqtt.Client, t time.Time
 
 }
 
-func deviceFlagStatus(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+func deviceFlagStatus(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
 
-	uc := <-ucc
+	uc, err := acquire(ctx, ucc)
+	if err != nil {
+		return err
+	}
 
 	defer func() { ucc <- uc }()
 
-	flags, err := axpert.DeviceFlagStatus(uc)
+	flags, err := inverterProtocol.DeviceFlagStatus(ctx, uc)
+	if err != nil {
+		return err
+	}
 	msgData := messageData{Timestamp: t, MessageType: "Flags", Data: flags}
 	err = sendInverterMessage(msgData, client)
 	if err != nil {
@@ -219,13 +635,19 @@ func deviceFlagStatus(ucc chan connector.Connector, client mqtt.Client, t time.T
 
 }
 
-func deviceRating(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+func deviceRating(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
 
-	uc := <-ucc
+	uc, err := acquire(ctx, ucc)
+	if err != nil {
+		return err
+	}
 
 	defer func() { ucc <- uc }()
 
-	ratingInfo, err := axpert.DeviceRatingInfo(uc)
+	ratingInfo, err := inverterProtocol.DeviceRatingInfo(ctx, uc)
+	if err != nil {
+		return err
+	}
 	msgData := messageData{Timestamp: t, MessageType: "RatingInfo", Data: ratingInfo}
 	err = sendInverterMessage(msgData, client)
 	if err != nil {
@@ -236,54 +658,301 @@ func deviceRating(ucc chan connector.Connector, client mqtt.Client, t time.Time)
 
 }
 
-func batteryStatus(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+// Returns the query for the status of the battery group at address.
+func batteryStatus(address byte) queryFunc {
+	return func(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
 
-	uc := <-ucc
+		uc, err := acquire(ctx, ucc)
+		if err != nil {
+			return err
+		}
 
-	defer func() { ucc <- uc }()
+		defer func() { ucc <- uc }()
 
-	batteryStatus, err := pylontech.GetBatteryStatus(uc)
-	msgData := messageData{Timestamp: t, MessageType: "BatteryStatus", Data: batteryStatus}
-	err = sendBatteryMessage(msgData, client)
-	if err != nil {
-		return err
+		batteryStatus, err := pylontech.GetBatteryStatusAtContext(ctx, uc, address)
+		if err != nil {
+			return err
+		}
+		msgData := messageData{Timestamp: t, MessageType: "BatteryStatus", Data: batteryStatus}
+		err = sendBatteryMessage(msgData, address, client)
+		if err != nil {
+			return err
+		}
+
+		msgData = messageData{Timestamp: t, MessageType: "Analytics", Data: batteryStatus.Analytics()}
+		err = sendMessage(msgData, batteryGroupTopic(address)+"/"+msgData.MessageType, client)
+		if err != nil {
+			return err
+		}
+
+		// Publish every pack by serial number as well, as positions change when
+		// packs are re-cabled. Packs without serial number are published by
+		// position.
+		serialNumbers, err := packSerialNumbers(ctx, uc, address, len(batteryStatus.Status))
+		if err != nil {
+			return err
+		}
+		for i, status := range batteryStatus.Status {
+			serialNumber := serialNumbers[i]
+			topic := batteryTopic + "/" + serialNumber
+			if serialNumber == "" {
+				topic = fmt.Sprintf("%s/Pack%d", batteryGroupTopic(address), i+1)
+			}
+
+			if serialNumber != "" && !packIdentities[serialNumber] {
+				identity, err := pylontech.GetPackIdentityAtContext(ctx, uc, address, byte(i+1))
+				switch {
+				case err == nil:
+					msgData := messageData{Timestamp: t, MessageType: "Identity", Data: identity}
+					err = sendMessage(msgData, topic+"/"+msgData.MessageType, client)
+					if err != nil {
+						return err
+					}
+				case unsupported(err):
+					slog.Warn("pack identity not available", "address", address, "pack", i+1, "error", err)
+				default:
+					return err
+				}
+				packIdentities[serialNumber] = true
+			}
+
+			msgData := messageData{Timestamp: t, MessageType: "BatteryStatus", Data: packStatus{Address: address, Position: i + 1, BatteryStatus: status}}
+			err = sendMessage(msgData, topic, client)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
 	}
+}
 
-	return nil
+// Returns the serial numbers of the count packs of the battery group at
+// address, from packSerials if the count has not changed. Packs that do not
+// report a serial number are left empty.
+func packSerialNumbers(ctx context.Context, c connector.Connector, address byte, count int) ([]string, error) {
+	if serialNumbers, ok := packSerials[address]; ok && len(serialNumbers) == count {
+		return serialNumbers, nil
+	}
+
+	serialNumbers := make([]string, count)
+	for i := range serialNumbers {
+		serialNumber, err := pylontech.GetSerialNumberAtContext(ctx, c, address, byte(i+1))
+		if unsupported(err) || errors.Is(err, pylontech.ErrShortResponse) {
+			slog.Warn("pack serial number not available, publishing by position", "address", address, "pack", i+1, "error", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		serialNumbers[i] = serialNumber
+	}
+
+	packSerials[address] = serialNumbers
+	return serialNumbers, nil
+}
+
+// Returns the query for the alarm info of the battery group at address.
+func alarmInfo(address byte) queryFunc {
+	return func(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+
+		uc, err := acquire(ctx, ucc)
+		if err != nil {
+			return err
+		}
+
+		defer func() { ucc <- uc }()
+
+		alarmInfo, err := pylontech.GetAlarmInfoAtContext(ctx, uc, address)
+		if err != nil {
+			return err
+		}
+		msgData := messageData{Timestamp: t, MessageType: "AlarmInfo", Data: alarmInfo}
+		err = sendMessage(msgData, batteryGroupTopic(address)+"/"+msgData.MessageType, client)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// Sniffs the traffic on c until ctx is done. The ReconnectConnector rc only
+// reconnects on writes, which the sniffer never makes, so it is reopened here
+// with backoff whenever the sniffer stops.
+func sniff(ctx context.Context, c connector.Connector, rc *connector.ReconnectConnector, handle func(*pylontech.SnifferEvent)) {
+	minDelay := reconnectConfig.MinBackoff
+	if minDelay <= 0 {
+		minDelay = time.Second
+	}
+	maxDelay := max(reconnectConfig.MaxBackoff, minDelay)
+
+	sniffer := pylontech.NewSniffer(c)
+	delay := minDelay
+	for {
+		err := sniffer.Run(ctx, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("battery sniffer stopped, reopening", "error", err, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		err = rc.Open()
+		if err != nil {
+			delay = min(delay*2, maxDelay)
+			continue
+		}
+		delay = minDelay
+	}
+}
+
+// A frame seen on the battery bus while sniffing
+type sniffedFrame struct {
+	Raw      string
+	Response bool
+	Address  byte
+	Command  string `json:",omitempty"`
+	Code     byte
+	Info     string `json:",omitempty"`
+	Data     any    `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
 
+func newSniffedFrame(ev *pylontech.SnifferEvent) sniffedFrame {
+	sf := sniffedFrame{Raw: string(ev.Raw), Response: ev.Response, Code: ev.Code, Data: ev.Data}
+	if ev.Frame != nil {
+		sf.Address = ev.Frame.Address
+		sf.Info = fmt.Sprintf("%X", ev.Frame.Info)
+	}
+	if ev.Command != 0 {
+		sf.Command = ev.Command.Name()
+	}
+	if ev.Err != nil {
+		sf.Error = ev.Err.Error()
+	}
+	return sf
+}
+
+// Returns the query publishing the battery status received over CAN.
+func canStatus(listener *can.Listener) queryFunc {
+	return func(ctx context.Context, _ chan connector.Connector, client mqtt.Client, t time.Time) error {
+		status := listener.Status()
+		if status.Updated.IsZero() {
+			return nil
+		}
+
+		msgData := messageData{Timestamp: t, MessageType: "CANStatus", Data: status}
+		return sendMessage(msgData, batteryTopic+"/"+msgData.MessageType, client)
+	}
 }
 
-func parallelDeviceInfo(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+func parallelDeviceInfo(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
 
-	uc := <-ucc
+	uc, err := acquire(ctx, ucc)
+	if err != nil {
+		return err
+	}
 
 	defer func() { ucc <- uc }()
 
+	// A failing inverter does not keep the others from being published, the
+	// query only fails when all of them do
+	var errs []error
 	for inv := 0; inv < inverterCount; inv++ {
-		deviceInfo, err := axpert.ParallelDeviceInfo(uc, inv)
+		deviceInfo, err := inverterProtocol.ParallelDeviceInfo(ctx, uc, inv)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf("inverter %d: %w", inv, err))
+			continue
+		}
+
+		if inverterProtocol == axpert.PI30 && !parallelPVUnsupported[inv] {
+			_, err = axpert.ParallelDeviceInfo2Context(ctx, uc, inv, deviceInfo)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, axpert.ErrTimeout) {
+				parallelPVTimeouts[inv]++
+			} else {
+				parallelPVTimeouts[inv] = 0
+			}
+
+			// The QPGS result is still published. Inverters without QP2GS
+			// answer NAK or, on some models, never answer at all.
+			switch {
+			case err == nil:
+			case unsupported(err) || parallelPVTimeouts[inv] >= maxUnsupported:
+				slog.Info("parallel PV info not supported", "inverter", inv, "error", err)
+				parallelPVUnsupported[inv] = true
+			default:
+				slog.Warn("parallel PV info failed", "inverter", inv, "error", err)
+			}
 		}
+
 		msgData := messageData{Timestamp: t, MessageType: "DeviceInfo", Data: deviceInfo}
 		err = sendInverterMessage(msgData, client)
 		if err != nil {
 			return err
 		}
+
+		err = publishFault(inv, deviceInfo.FaultCode, client, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(errs) == inverterCount {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		slog.Warn("parallel device info failed", "error", err)
 	}
 	return nil
 }
 
-func deviceMode(ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+// Publishes the decoded fault code of the inverter and, when it differs from
+// the previous poll, the transition. Inverters start out without fault.
+func publishFault(inv int, code axpert.FaultCode, client mqtt.Client, t time.Time) error {
+	fault := inverterFault{Inverter: inv, Code: code, Description: code.Description(), Severity: code.Severity()}
+	msgData := messageData{Timestamp: t, MessageType: "Fault", Data: fault}
+	err := sendInverterMessage(msgData, client)
+	if err != nil {
+		return err
+	}
 
-	uc := <-ucc
+	previous := inverterFaults[inv]
+	if code == previous {
+		return nil
+	}
+	inverterFaults[inv] = code
+
+	if code == axpert.FaultNone {
+		slog.Info("inverter fault cleared", "inverter", inv, "fault", previous.Description())
+	} else {
+		slog.Warn("inverter fault", "inverter", inv, "code", uint8(code), "fault", code.Description())
+	}
+	msgData = messageData{Timestamp: t, MessageType: "FaultTransition", Data: faultTransition{inverterFault: fault, Previous: previous}}
+	return sendInverterMessage(msgData, client)
+}
+
+func deviceMode(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+
+	uc, err := acquire(ctx, ucc)
+	if err != nil {
+		return err
+	}
 
 	defer func() { ucc <- uc }()
 
-	mode, err := axpert.DeviceMode(uc)
+	mode, err := inverterProtocol.DeviceMode(ctx, uc)
 	if err != nil {
 		return err
 	}
-	m := map[string]string{"Mode": mode}
+	m := map[string]axpert.Mode{"Mode": mode}
 	msgData := messageData{Timestamp: t, MessageType: "Mode", Data: m}
 	err = sendInverterMessage(msgData, client)
 	if err != nil {
@@ -297,8 +966,17 @@ func sendInverterMessage(data messageData, client mqtt.Client) error {
 	return sendMessage(data, inverterTopic+"/"+data.MessageType, client)
 }
 
-func sendBatteryMessage(data messageData, client mqtt.Client) error {
-	return sendMessage(data, batteryTopic, client)
+func sendBatteryMessage(data messageData, address byte, client mqtt.Client) error {
+	return sendMessage(data, batteryGroupTopic(address), client)
+}
+
+// Returns the topic of the battery group at address, the battery topic
+// itself for the first group.
+func batteryGroupTopic(address byte) string {
+	if address == 1 {
+		return batteryTopic
+	}
+	return fmt.Sprintf("%s/Group%d", batteryTopic, address)
 }
 
 func sendMessage(data messageData, topic string, client mqtt.Client) error {
@@ -316,36 +994,118 @@ func messageReceiver(client mqtt.Client, msg mqtt.Message) {
 	go func() {
 		switch msg.Topic() {
 		case "inverter/cmd/setOutputSourcePriority":
-			fmt.Printf("%s\n", msg.Topic())
-			msg.Topic()
-			msg.Payload()
-			uc := <-ucc
+			slog.Info("received command", "topic", msg.Topic(), "payload", string(msg.Payload()))
+			ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+			defer cancel()
+
+			uc, err := acquire(ctx, ucc)
+			if err != nil {
+				slog.Warn("inverter busy", "error", err)
+				return
+			}
 
 			defer func() { ucc <- uc }()
 			priority, err := strconv.Atoi(string(msg.Payload()))
 			if err != nil {
-				fmt.Println("Value conversion error", err)
+				slog.Warn("invalid output source priority", "error", err)
 				return
 			}
 
-			err = axpert.SetOutputSourcePriority(uc, axpert.OutputSourcePriority(priority))
+			err = inverterProtocol.SetOutputSourcePriority(ctx, uc, axpert.OutputSourcePriority(priority))
 			if err != nil {
-				fmt.Println("Failed sending command ", err)
+				slog.Error("failed sending command", "topic", msg.Topic(), "error", err)
 				return
 			}
 
 		default:
-			fmt.Printf("%s", msg.Topic())
+			slog.Warn("unknown command", "topic", msg.Topic())
 		}
 	}()
 }
 
+// Payload of a battery/cmd/turnOff message, the serial number has to match
+// the pack as confirmation. The address defaults to the first group.
+type turnOffRequest struct {
+	Address      byte
+	Pack         byte
+	SerialNumber string
+}
+
+func turnOffReceiver(scc chan connector.Connector) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		go func() {
+			req := turnOffRequest{Address: 1}
+			err := json.Unmarshal(msg.Payload(), &req)
+			if err != nil {
+				slog.Warn("invalid turn off request", "error", err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+			defer cancel()
+
+			sc, err := acquire(ctx, scc)
+			if err != nil {
+				slog.Warn("battery busy", "error", err)
+				return
+			}
+
+			defer func() { scc <- sc }()
+
+			slog.Warn("turning off battery pack", "address", req.Address, "pack", req.Pack, "serialNumber", req.SerialNumber)
+			err = pylontech.TurnOffAtContext(ctx, sc, req.Address, req.Pack, req.SerialNumber)
+			if err != nil {
+				slog.Error("failed sending command", "topic", msg.Topic(), "error", err)
+				return
+			}
+		}()
+	}
+}
+
+// Returns a logger writing to stderr at level (debug, info, warn or error)
+// in format text or json.
+func newLogger(level string, format string) (*slog.Logger, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, must be text or json", format)
+}
+
+// Returns a copy of the settings for logging with the values of passwords,
+// secrets and tokens replaced.
+func redactSettings(settings map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		lower := strings.ToLower(key)
+		switch {
+		case strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token"):
+			redacted[key] = "REDACTED"
+		default:
+			if nested, ok := value.(map[string]interface{}); ok {
+				value = redactSettings(nested)
+			}
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
 func logConnect(_ mqtt.Client) {
-	fmt.Println("Connected to broker")
+	slog.Info("connected to broker")
 }
 
 func logConnectionLost(_ mqtt.Client, err error) {
-	fmt.Println("Connection lost:", err)
+	slog.Warn("connection to broker lost", "error", err)
 }
 
 func initConfig() error {
@@ -357,10 +1117,23 @@ func initConfig() error {
 	viper.SetDefault("mqtt.port", 1883)
 	viper.SetDefault("mqtt.clientid", "datalogd")
 	viper.SetDefault("timer.interval", 30)
+	viper.SetDefault("inverter.baud", 2400)
 	viper.SetDefault("inverter.count", 1)
 	viper.SetDefault("inverter.topic", "datalogd/inverter")
+	viper.SetDefault("inverter.protocol", "auto")
 	viper.SetDefault("battery.baud", 1200)
 	viper.SetDefault("battery.topic", "datalogd/battery")
+	viper.SetDefault("battery.allowTurnOff", false)
+	viper.SetDefault("battery.sniff", false)
+	viper.SetDefault("battery.scanLast", 8)
+	viper.SetDefault("battery.scanTimeout", time.Second)
+	viper.SetDefault("reconnect.minBackoff", time.Second)
+	viper.SetDefault("reconnect.maxBackoff", 2*time.Minute)
+	viper.SetDefault("reconnect.maxTimeouts", 5)
+	viper.SetDefault("reconnect.countDeadlines", false)
+	viper.SetDefault("trace.enabled", false)
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", "text")
 
 	viper.SetEnvPrefix("dlog")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
@@ -373,13 +1146,12 @@ func initConfig() error {
 	err := viper.ReadInConfig()
 	if err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			fmt.Println("Config file not found, relying on defaults/ENV")
+			slog.Info("config file not found, relying on defaults/ENV")
 		} else {
 			return err
 		}
 	}
 
-	fmt.Println("config: ", viper.AllSettings())
 	timerInterval = viper.GetInt("timer.interval")
 	mqttServer = viper.GetString("mqtt.server")
 	mqttPort = viper.GetInt("mqtt.port")
@@ -387,11 +1159,34 @@ func initConfig() error {
 	mqttPassword = viper.GetString("mqtt.password")
 	mqttClientId = viper.GetString("mqtt.clientId")
 	inverterPath = viper.GetString("inverter.path")
+	inverterRecord = viper.GetString("inverter.record")
+	inverterBaud = viper.GetInt("inverter.baud")
 	inverterCount = viper.GetInt("inverter.count")
 	inverterTopic = viper.GetString("inverter.topic")
+	inverterProtocolName = viper.GetString("inverter.protocol")
 	batteryPath = viper.GetString("battery.path")
+	batteryRecord = viper.GetString("battery.record")
 	batteryBaud = viper.GetInt("battery.baud")
 	batteryTopic = viper.GetString("battery.topic")
+	batteryAllowTurnOff = viper.GetBool("battery.allowTurnOff")
+	batteryCAN = viper.GetString("battery.can")
+	batterySniff = viper.GetBool("battery.sniff")
+	batteryAddresses = nil
+	for _, address := range viper.GetIntSlice("battery.addresses") {
+		batteryAddresses = append(batteryAddresses, byte(address))
+	}
+	batteryScanLast = viper.GetInt("battery.scanLast")
+	batteryScanTimeout = viper.GetDuration("battery.scanTimeout")
+	reconnectConfig = connector.ReconnectConfig{
+		MinBackoff:     viper.GetDuration("reconnect.minBackoff"),
+		MaxBackoff:     viper.GetDuration("reconnect.maxBackoff"),
+		MaxTimeouts:    viper.GetInt("reconnect.maxTimeouts"),
+		CountDeadlines: viper.GetBool("reconnect.countDeadlines"),
+	}
+	traceEnabled = viper.GetBool("trace.enabled")
+	logLevel = viper.GetString("log.level")
+	logFormat = viper.GetString("log.format")
+	traceOutput = viper.GetString("trace.output")
 
 	return nil
 }
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/marevers/energia/pkg/axpert"
+	"github.com/marevers/energia/pkg/connector"
+	"github.com/marevers/energia/pkg/pylontech"
+	"github.com/marevers/energia/pkg/pylontech/can"
+)
+
+// Collects published messages, the remaining client methods are not used by
+// the polling loop.
+type fakeClient struct {
+	mqtt.Client
+	mu        sync.Mutex
+	published map[string][]byte
+}
+
+func (fc *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.published[topic] = payload.([]byte)
+	return &mqtt.DummyToken{}
+}
+
+func replayChannel(t *testing.T, path string) chan connector.Connector {
+	c, err := newConnector("replay://"+path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := make(chan connector.Connector, 1)
+	cc <- c
+	return cc
+}
+
+func TestPollQueriesReplay(t *testing.T) {
+	inverterTopic = "test/inverter"
+	batteryTopic = "test/battery"
+	batteryAddresses = []byte{1}
+	inverterCount = 1
+
+	client := &fakeClient{published: make(map[string][]byte)}
+	ucc := replayChannel(t, "../../pkg/axpert/testdata/session-pi30.jsonl")
+	scc := replayChannel(t, "../../pkg/pylontech/testdata/session-us3000.jsonl")
+
+	// Two rounds, as the daemon keeps polling the same queries
+	for round := 0; round < 2; round++ {
+		for _, q := range pollQueries(ucc, scc) {
+			err := q.f(context.Background(), q.cc, client, time.Now())
+			if err != nil {
+				t.Fatalf("round %d: query error = %v", round, err)
+			}
+		}
+	}
+
+	topics := []string{
+		"test/inverter/Mode",
+		"test/inverter/DeviceInfo",
+		"test/inverter/Status",
+		"test/inverter/Flags",
+		"test/inverter/Warnings",
+		"test/inverter/RatingInfo",
+		"test/battery",
+		"test/battery/AlarmInfo",
+		"test/battery/Analytics",
+		"test/battery/PPTAP01234567801",
+		"test/battery/PPTAP01234567802/Identity",
+	}
+	for _, topic := range topics {
+		msg, ok := client.published[topic]
+		if !ok {
+			t.Errorf("no message published to %s", topic)
+			continue
+		}
+		var data messageData
+		err := json.Unmarshal(msg, &data)
+		if err != nil {
+			t.Errorf("invalid message on %s: %v", topic, err)
+		}
+	}
+}
+
+type frameSlice []can.Frame
+
+func (fs *frameSlice) ReadFrame() (can.Frame, error) {
+	if len(*fs) == 0 {
+		return can.Frame{}, io.EOF
+	}
+	f := (*fs)[0]
+	*fs = (*fs)[1:]
+	return f, nil
+}
+
+func TestCANStatus(t *testing.T) {
+	batteryTopic = "test/battery"
+	client := &fakeClient{published: make(map[string][]byte)}
+	listener := can.NewListener(&frameSlice{{ID: 0x355, Data: []byte{0x3C, 0x00, 0x64, 0x00}}})
+
+	q := canStatus(listener)
+	err := q(context.Background(), nil, client, time.Now())
+	if err != nil || len(client.published) != 0 {
+		t.Errorf("canStatus() published %d messages before any frame, error = %v", len(client.published), err)
+	}
+
+	listener.Run(context.Background())
+	err = q(context.Background(), nil, client, time.Now())
+	if err != nil {
+		t.Fatalf("canStatus() error = %v", err)
+	}
+
+	var msg struct{ Data can.Status }
+	err = json.Unmarshal(client.published["test/battery/CANStatus"], &msg)
+	if err != nil || msg.Data.SOC != 60 || msg.Data.SOH != 100 {
+		t.Errorf("canStatus() published = %s, error = %v", client.published["test/battery/CANStatus"], err)
+	}
+}
+
+func TestPublishFault(t *testing.T) {
+	inverterTopic = "test/inverter"
+	client := &fakeClient{published: make(map[string][]byte)}
+
+	var msg struct{ Data faultTransition }
+	for _, code := range []axpert.FaultCode{axpert.FaultNone, axpert.FaultBusVoltageLow, axpert.FaultBusVoltageLow, axpert.FaultNone} {
+		delete(client.published, "test/inverter/FaultTransition")
+		err := publishFault(1, code, client, time.Now())
+		if err != nil {
+			t.Fatalf("publishFault() error = %v", err)
+		}
+		if _, ok := client.published["test/inverter/Fault"]; !ok {
+			t.Errorf("publishFault(%d) published no fault", uint8(code))
+		}
+
+		transition, ok := client.published["test/inverter/FaultTransition"]
+		if ok != (code != msg.Data.Code) {
+			t.Errorf("publishFault(%d) published transition = %v, previous %d", uint8(code), ok, uint8(msg.Data.Code))
+		}
+		if ok {
+			err = json.Unmarshal(transition, &msg)
+			if err != nil || msg.Data.Inverter != 1 || msg.Data.Code != code || msg.Data.Description != code.Description() {
+				t.Errorf("publishFault(%d) published = %s, error = %v", uint8(code), transition, err)
+			}
+		}
+	}
+}
+
+func TestDeviceGeneralStatus2(t *testing.T) {
+	inverterTopic = "test/inverter"
+	inverterProtocol = axpert.PI30
+	client := &fakeClient{published: make(map[string][]byte)}
+	sim := axpert.NewSimulator()
+	ucc := make(chan connector.Connector, 1)
+	ucc <- sim.Connector()
+
+	inverterStatus2 = detectStatus2(context.Background(), sim.Connector())
+	if !inverterStatus2 {
+		t.Fatal("detectStatus2() = false, want true")
+	}
+
+	var msg struct{ Data axpert.DeviceStatusParams }
+	for _, want := range []int{856, 0} {
+		err := deviceGeneralStatus(context.Background(), ucc, client, time.Now())
+		if err != nil {
+			t.Fatalf("deviceGeneralStatus() error = %v", err)
+		}
+		err = json.Unmarshal(client.published["test/inverter/Status"], &msg)
+		if err != nil || msg.Data.BatteryVoltage != 57.5 || msg.Data.PVTotalChargingPower != want {
+			t.Errorf("deviceGeneralStatus() published = %s, error = %v, want PVTotalChargingPower %d",
+				client.published["test/inverter/Status"], err, want)
+		}
+
+		// Units that stop answering QPIGS2 still publish their status
+		sim.SetUnsupported("QPIGS2")
+	}
+	if inverterStatus2 {
+		t.Error("inverterStatus2 = true after NAK, want false")
+	}
+
+	if detectStatus2(context.Background(), sim.Connector()) {
+		t.Error("detectStatus2() = true after NAK, want false")
+	}
+}
+
+// Returns a query that fails with errs in turn and the number of its runs.
+func countingQuery(errs ...error) (queryFunc, func() int) {
+	var mu sync.Mutex
+	calls := 0
+	f := func(ctx context.Context, ucc chan connector.Connector, client mqtt.Client, t time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return errs[(calls-1)%len(errs)]
+	}
+	return f, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func TestScheduleUnsupported(t *testing.T) {
+	// Occasional NAKs keep the query running
+	f, count := countingQuery(axpert.ErrNotSupported, axpert.ErrNotSupported, nil)
+	ticker := schedule(context.Background(), f, time.Millisecond, nil, nil)
+	defer ticker.Stop()
+	for deadline := time.Now().Add(5 * time.Second); count() < 7 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if count() < 7 {
+		t.Errorf("schedule() ran %d times, want at least 7", count())
+	}
+
+	// NAKs in a row disable it
+	f, count = countingQuery(axpert.ErrNotSupported)
+	schedule(context.Background(), f, time.Millisecond, nil, nil)
+	time.Sleep(50 * time.Millisecond)
+	if count() != maxUnsupported {
+		t.Errorf("schedule() ran %d times, want %d", count(), maxUnsupported)
+	}
+}
+
+func TestParallelDeviceInfoPartial(t *testing.T) {
+	inverterTopic = "test/inverter"
+	inverterProtocol = axpert.PI30
+	inverterCount = 2
+	defer func() { inverterCount = 1 }()
+
+	client := &fakeClient{published: make(map[string][]byte)}
+	ucc := make(chan connector.Connector, 1)
+	ucc <- axpert.NewSimulator().Connector()
+
+	// The simulator has a single inverter, QPGS1 is answered with NAK
+	err := parallelDeviceInfo(context.Background(), ucc, client, time.Now())
+	if err != nil {
+		t.Errorf("parallelDeviceInfo() error = %v", err)
+	}
+	if _, ok := client.published["test/inverter/DeviceInfo"]; !ok {
+		t.Error("parallelDeviceInfo() published no device info")
+	}
+}
+
+func TestParallelPVUnsupported(t *testing.T) {
+	inverterTopic = "test/inverter"
+	inverterProtocol = axpert.PI30
+	inverterCount = 1
+	clear(parallelPVUnsupported)
+	clear(parallelPVTimeouts)
+	client := &fakeClient{published: make(map[string][]byte)}
+	sim := axpert.NewSimulator()
+	sim.SetUnsupported("QP2GS0")
+
+	// Counts the QP2GS requests
+	pvRequests := 0
+	ucc := make(chan connector.Connector, 1)
+	ucc <- connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		if strings.HasPrefix(string(request), "QP2GS") {
+			pvRequests++
+		}
+		return sim.Respond(request)
+	}))
+
+	// QP2GS is not sent again after the NAK
+	for round := 0; round < 2; round++ {
+		err := parallelDeviceInfo(context.Background(), ucc, client, time.Now())
+		if err != nil {
+			t.Fatalf("round %d: parallelDeviceInfo() error = %v", round, err)
+		}
+	}
+	if pvRequests != 1 {
+		t.Errorf("parallelDeviceInfo() sent %d QP2GS requests, want 1", pvRequests)
+	}
+	if _, ok := client.published["test/inverter/DeviceInfo"]; !ok {
+		t.Error("parallelDeviceInfo() published no device info")
+	}
+}
+
+func TestParallelPVTimeout(t *testing.T) {
+	inverterTopic = "test/inverter"
+	inverterProtocol = axpert.PI30
+	inverterCount = 1
+	clear(parallelPVUnsupported)
+	clear(parallelPVTimeouts)
+	client := &fakeClient{published: make(map[string][]byte)}
+	sim := axpert.NewSimulator()
+	sim.SetParallelInfo(axpert.ParallelInfo{DeviceExists: true, PV2ChargingPower: 310})
+
+	// Drops the first QP2GS request
+	dropped := false
+	ucc := make(chan connector.Connector, 1)
+	ucc <- connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		if strings.HasPrefix(string(request), "QP2GS") && !dropped {
+			dropped = true
+			return nil
+		}
+		return sim.Respond(request)
+	}))
+
+	// A single timeout keeps QP2GS enabled
+	var msg struct{ Data axpert.ParallelInfo }
+	for round := 0; round < 2; round++ {
+		err := parallelDeviceInfo(context.Background(), ucc, client, time.Now())
+		if err != nil {
+			t.Fatalf("round %d: parallelDeviceInfo() error = %v", round, err)
+		}
+	}
+	err := json.Unmarshal(client.published["test/inverter/DeviceInfo"], &msg)
+	if err != nil || msg.Data.PV2ChargingPower != 310 || parallelPVUnsupported[0] {
+		t.Errorf("parallelDeviceInfo() published = %s, error = %v", client.published["test/inverter/DeviceInfo"], err)
+	}
+}
+
+func TestBatteryStatusSerialNumbers(t *testing.T) {
+	batteryTopic = "test/battery"
+	clear(packSerials)
+	clear(packIdentities)
+	client := &fakeClient{published: make(map[string][]byte)}
+	sim := pylontech.NewSimulator(
+		pylontech.NewSimulatorPack("PPTAP01234567801", 15, 5, 74),
+		pylontech.NewSimulatorPack("", 15, 5, 74),
+	)
+
+	// Counts the serial number requests
+	serialRequests := 0
+	scc := make(chan connector.Connector, 1)
+	scc <- connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		if string(request[7:9]) == "93" {
+			serialRequests++
+		}
+		return sim.Respond(request)
+	}))
+
+	// The serial numbers are only read on the first poll
+	q := batteryStatus(1)
+	var requests []int
+	for round := 0; round < 2; round++ {
+		err := q(context.Background(), scc, client, time.Now())
+		if err != nil {
+			t.Fatalf("round %d: batteryStatus() error = %v", round, err)
+		}
+		requests = append(requests, serialRequests)
+	}
+	if requests[0] == 0 || requests[1] != requests[0] {
+		t.Errorf("batteryStatus() sent %v serial number requests after each round, want none in the second", requests)
+	}
+	for _, topic := range []string{"test/battery/PPTAP01234567801", "test/battery/Pack2"} {
+		if _, ok := client.published[topic]; !ok {
+			t.Errorf("no message published to %s", topic)
+		}
+	}
+	if _, ok := client.published["test/battery/"]; ok {
+		t.Error("message published to the empty serial number")
+	}
+}
+
+// Fails its first read with an I/O error, then returns frame once and times
+// out afterwards.
+type droppingConnector struct {
+	mu    sync.Mutex
+	opens int
+	reads int
+	frame []byte
+}
+
+func (dc *droppingConnector) Open() error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.opens++
+	return nil
+}
+
+func (dc *droppingConnector) Close() {}
+
+func (dc *droppingConnector) ReadUntilCR() ([]byte, error) { return dc.Read(0x0d) }
+
+func (dc *droppingConnector) Read(terminator byte) ([]byte, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.reads++
+	switch dc.reads {
+	case 1:
+		return nil, io.ErrUnexpectedEOF
+	case 2:
+		return dc.frame, nil
+	}
+	time.Sleep(time.Millisecond)
+	return nil, connector.ErrTimeout
+}
+
+func (dc *droppingConnector) Write(bytes []byte) error { return nil }
+
+func TestSniffReconnects(t *testing.T) {
+	reconnectConfig = connector.ReconnectConfig{MinBackoff: time.Millisecond}
+	defer func() { reconnectConfig = connector.ReconnectConfig{} }()
+
+	frame, err := pylontech.NewFrame(1, 0x42, []byte{0xff}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := &droppingConnector{frame: frame}
+	rc := connector.NewReconnectConnector(dc, reconnectConfig)
+	rc.Open()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []*pylontech.SnifferEvent
+	sniff(ctx, rc, rc, func(ev *pylontech.SnifferEvent) {
+		events = append(events, ev)
+		cancel()
+	})
+
+	if len(events) != 1 || events[0].Err != nil {
+		t.Errorf("sniff() got events %+v, want the frame after reconnecting", events)
+	}
+	if dc.opens != 2 {
+		t.Errorf("sniff() opened the connector %d times, want 2", dc.opens)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{level: "info", format: "text"},
+		{level: "DEBUG", format: "json"},
+		{level: "verbose", format: "text", wantErr: true},
+		{level: "warn", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level+"/"+tt.format, func(t *testing.T) {
+			_, err := newLogger(tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedactSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"mqtt": map[string]interface{}{"server": "localhost", "username": "energia", "password": "secret"},
+		"log":  map[string]interface{}{"level": "debug"},
+	}
+	redacted := redactSettings(settings)
+	mqttSettings := redacted["mqtt"].(map[string]interface{})
+	if mqttSettings["password"] != "REDACTED" || mqttSettings["username"] != "energia" || mqttSettings["server"] != "localhost" {
+		t.Errorf("redactSettings() mqtt = %v", mqttSettings)
+	}
+	if settings["mqtt"].(map[string]interface{})["password"] != "secret" {
+		t.Error("redactSettings() modified the settings")
+	}
+}
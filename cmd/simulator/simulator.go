@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+
+	"github.com/marevers/energia/pkg/axpert"
+	"github.com/marevers/energia/pkg/connector"
+	"github.com/marevers/energia/pkg/pylontech"
+)
+
+// Runs virtual devices for developing and testing datalogd without hardware,
+// served over TCP (tcp:// paths in datalogd) and/or a pseudo-terminal.
+func main() {
+	var inverterListen string
+	var inverterPTY bool
+	pflag.StringVar(&inverterListen, "inverter-listen", "", "TCP address to serve the inverter on, e.g. :8899")
+	pflag.BoolVar(&inverterPTY, "inverter-pty", false, "Serve the inverter on a pseudo-terminal")
+	var batteryListen string
+	var batteryPTY bool
+	var batteryGroups int
+	var batteryPacks int
+	var batteryCells int
+	var batteryTemps int
+	var batteryCapacity float32
+	pflag.StringVar(&batteryListen, "battery-listen", "", "TCP address to serve the battery stack on, e.g. :8898")
+	pflag.BoolVar(&batteryPTY, "battery-pty", false, "Serve the battery stack on a pseudo-terminal")
+	pflag.IntVar(&batteryGroups, "battery-groups", 1, "Number of battery groups, at addresses 1 and up")
+	pflag.IntVar(&batteryPacks, "battery-packs", 2, "Number of battery packs per group")
+	pflag.IntVar(&batteryCells, "battery-cells", 15, "Number of cells per pack")
+	pflag.IntVar(&batteryTemps, "battery-temps", 5, "Number of temperature sensors per pack")
+	pflag.Float32Var(&batteryCapacity, "battery-capacity", 74, "Capacity per pack in Ah")
+	pflag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	inverter := axpert.NewSimulator()
+
+	if inverterListen != "" {
+		err := serveTCP(ctx, inverterListen, inverter)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("inverter listening", "address", inverterListen)
+	}
+	if inverterPTY {
+		path, err := servePTY(ctx, inverter)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("inverter on pseudo-terminal", "path", path)
+	}
+
+	groups := make([]*pylontech.Simulator, batteryGroups)
+	for g := range groups {
+		packs := make([]pylontech.SimulatorPack, batteryPacks)
+		for i := range packs {
+			packs[i] = pylontech.NewSimulatorPack(fmt.Sprintf("PPTAP01234%02d%04d", g+1, i+1), batteryCells, batteryTemps, batteryCapacity)
+		}
+		groups[g] = pylontech.NewSimulator(packs...)
+		groups[g].SetAddress(byte(g + 1))
+	}
+	// All groups share the bus, only the addressed one answers
+	battery := connector.ResponderFunc(func(request []byte) []byte {
+		for _, group := range groups {
+			if resp := group.Respond(request); resp != nil {
+				return resp
+			}
+		}
+		return nil
+	})
+
+	if batteryListen != "" {
+		err := serveTCP(ctx, batteryListen, battery)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("battery listening", "address", batteryListen)
+	}
+	if batteryPTY {
+		path, err := servePTY(ctx, battery)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("battery on pseudo-terminal", "path", path)
+	}
+
+	<-ctx.Done()
+	slog.Info("exiting")
+}
+
+func serveTCP(ctx context.Context, address string, r connector.Responder) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := connector.ServeListener(ctx, l, 0x0d, r)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("serving failed", "address", address, "error", err)
+		}
+	}()
+	return nil
+}
+
+func servePTY(ctx context.Context, r connector.Responder) (string, error) {
+	pty, err := connector.OpenPTY()
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		defer pty.Close()
+		err := connector.Serve(ctx, pty, 0x0d, r)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("serving failed", "path", pty.Path, "error", err)
+		}
+	}()
+	return pty.Path, nil
+}
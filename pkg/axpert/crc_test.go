@@ -24,3 +24,23 @@ func TestValidateResponse(t *testing.T) {
 	}
 
 }
+
+func TestDescribeFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "Request", data: "QPIGS\xb7\xa9\r", want: `request "QPIGS" crc=B7A9 ok`},
+		{name: "Response", data: "(NAKss\r", want: `response "NAK" crc=7373 ok`},
+		{name: "Bad CRC", data: "(NAKsx\r", want: `response "NAK" crc=7378 mismatch, expected 7373`},
+		{name: "Incomplete", data: "(NA", want: "incomplete frame"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DescribeFrame([]byte(tt.data)); got != tt.want {
+				t.Errorf("DescribeFrame() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
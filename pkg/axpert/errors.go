@@ -0,0 +1,48 @@
+package axpert
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+var (
+	// The inverter answered NAK to a command
+	ErrNAK = errors.New("command not acknowledged")
+	// The inverter answered NAK to a query, it does not implement it
+	ErrNotSupported = errors.New("query not supported")
+	// The response CRC does not match its contents
+	ErrChecksum = errors.New("CRC error")
+	// The response is not enclosed in ( and CR
+	ErrFraming = errors.New("framing error")
+	// The response has fewer fields than the query returns
+	ErrShortResponse = errors.New("response too short")
+	// QPI reported a protocol the package does not implement
+	ErrUnknownProtocol = errors.New("unknown protocol")
+	// No response arrived in time, the same error as connector.ErrTimeout
+	ErrTimeout = connector.ErrTimeout
+)
+
+// ParseError is returned when a response is framed correctly but its
+// contents cannot be decoded.
+type ParseError struct {
+	Query    string
+	Response string
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid response to %s: %v", e.Query, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func parseError(query string, resp string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ParseError{Query: query, Response: resp, Err: err}
+}
@@ -0,0 +1,90 @@
+package axpert
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+func TestErrors(t *testing.T) {
+	sim := NewSimulator()
+	sim.SetUnsupported("QPIGS2")
+
+	// Answers with fixed responses, or passes requests to the simulator
+	c := connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		switch string(request[:len(request)-3]) {
+		case "QID":
+			return []byte("(123\xff\xff\r")
+		case "QMOD":
+			return []byte("B\xe7\xc9\r")
+		case "QPIWS":
+			return simFrame("0000")
+		case "QPIRI":
+			return simFrame("230.0 21.7 230.0 50.0 21.7 5000 4000 48.0 48.0 47.5 53.2 51.9 2 30 120 0 0 1 9 01 0 0 51.0 0 x")
+		case "QPI":
+			return nil
+		}
+		return sim.Respond(request)
+	}))
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{name: "NAK", call: func() error { return SetOutputSourcePriority(c, OutputSourcePriority(7)) }, want: ErrNAK},
+		{name: "Not supported", call: func() error { _, err := DeviceGeneralStatus2(c, &DeviceStatusParams{}); return err }, want: ErrNotSupported},
+		{name: "Checksum", call: func() error { _, err := SerialNo(c); return err }, want: ErrChecksum},
+		{name: "Framing", call: func() error { _, err := DeviceMode(c); return err }, want: ErrFraming},
+		{name: "Short response", call: func() error { _, err := WarningStatus(c); return err }, want: ErrShortResponse},
+		{name: "Timeout", call: func() error { _, err := ProtocolId(c); return err }, want: ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, tt.want) {
+				t.Errorf("got error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	_, err := DeviceRatingInfo(c)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Query != "QPIRI" {
+		t.Errorf("DeviceRatingInfo() error = %v, want ParseError for QPIRI", err)
+	}
+}
+
+func TestParallelDeviceInfo2Errors(t *testing.T) {
+	sim := NewSimulator()
+
+	// Passes requests to the simulator, QP2GS0 is not answered and QP2GS2 is
+	// answered with a short response
+	c := connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		switch string(request[:len(request)-3]) {
+		case "QP2GS0":
+			return nil
+		case "QP2GS2":
+			return simFrame("08 00420")
+		}
+		return sim.Respond(request)
+	}))
+	sim.SetParallelInfo(ParallelInfo{PVChargingCurrent: 9}, ParallelInfo{}, ParallelInfo{})
+	sim.SetUnsupported("QP2GS1")
+
+	want := []error{ErrTimeout, ErrNotSupported, ErrShortResponse}
+	for index, wantErr := range want {
+		info, err := ParallelDeviceInfo(c, index)
+		if err != nil || info.DeviceIndex != index {
+			t.Fatalf("ParallelDeviceInfo(%d) got = %+v, %v", index, info, err)
+		}
+		qpgs := *info
+		info, err = ParallelDeviceInfo2(c, index, info)
+		if !errors.Is(err, wantErr) {
+			t.Errorf("ParallelDeviceInfo2(%d) error = %v, want %v", index, err, wantErr)
+		}
+		if *info != qpgs {
+			t.Errorf("ParallelDeviceInfo2(%d) changed the QPGS result to %+v", index, *info)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package axpert
+
+import "fmt"
+
+// Fault codes as reported by QPGS and shown on the display of PI30 inverters
+// in fault mode. Codes from 60 only occur in parallel systems.
+//
+//go:generate enumer -type=FaultCode -json -text
+type FaultCode uint8
+
+const (
+	FaultNone                     FaultCode = 0
+	FaultFanLocked                FaultCode = 1
+	FaultOverTemperature          FaultCode = 2
+	FaultBatteryVoltageHigh       FaultCode = 3
+	FaultBatteryVoltageLow        FaultCode = 4
+	FaultOutputShort              FaultCode = 5
+	FaultOutputVoltageHigh        FaultCode = 6
+	FaultOverloadTimeout          FaultCode = 7
+	FaultBusVoltageHigh           FaultCode = 8
+	FaultBusSoftStartFailed       FaultCode = 9
+	FaultPVOverCurrent            FaultCode = 10
+	FaultPVOverVoltage            FaultCode = 11
+	FaultDCDCOverCurrent          FaultCode = 12
+	FaultBatteryDischargeOverload FaultCode = 13
+	FaultOverCurrent              FaultCode = 51
+	FaultBusVoltageLow            FaultCode = 52
+	FaultInverterSoftStartFailed  FaultCode = 53
+	FaultOutputDCVoltageHigh      FaultCode = 55
+	FaultBatteryOpen              FaultCode = 56
+	FaultCurrentSensorFailed      FaultCode = 57
+	FaultOutputVoltageLow         FaultCode = 58
+	FaultPowerFeedback            FaultCode = 60
+	FaultFirmwareMismatch         FaultCode = 71
+	FaultCurrentSharing           FaultCode = 72
+	FaultCAN                      FaultCode = 80
+	FaultHostLoss                 FaultCode = 81
+	FaultSynchronizationLoss      FaultCode = 82
+	FaultBatteryVoltageMismatch   FaultCode = 83
+	FaultACInputMismatch          FaultCode = 84
+	FaultACOutputCurrentUnbalance FaultCode = 85
+	FaultOutputModeMismatch       FaultCode = 86
+)
+
+//go:generate enumer -type=FaultSeverity -json -text
+type FaultSeverity uint8
+
+const (
+	// No fault
+	SeverityNone FaultSeverity = iota
+	// The inverter recovers once the condition clears, such as an overload
+	SeverityMinor
+	// The wiring, settings or parallel setup need attention
+	SeverityMajor
+	// Likely a hardware failure of the inverter
+	SeverityCritical
+)
+
+type faultInfo struct {
+	description string
+	severity    FaultSeverity
+}
+
+var faults = map[FaultCode]faultInfo{
+	FaultNone:                     {"No fault", SeverityNone},
+	FaultFanLocked:                {"Fan is locked", SeverityMajor},
+	FaultOverTemperature:          {"Over temperature", SeverityMinor},
+	FaultBatteryVoltageHigh:       {"Battery voltage is too high", SeverityMinor},
+	FaultBatteryVoltageLow:        {"Battery voltage is too low", SeverityMinor},
+	FaultOutputShort:              {"Output short circuited or over temperature of internal converter components", SeverityCritical},
+	FaultOutputVoltageHigh:        {"Output voltage is too high", SeverityCritical},
+	FaultOverloadTimeout:          {"Overload time out", SeverityMinor},
+	FaultBusVoltageHigh:           {"Bus voltage is too high", SeverityCritical},
+	FaultBusSoftStartFailed:       {"Bus soft start failed", SeverityCritical},
+	FaultPVOverCurrent:            {"PV over current", SeverityMinor},
+	FaultPVOverVoltage:            {"PV over voltage", SeverityMinor},
+	FaultDCDCOverCurrent:          {"DC/DC over current", SeverityCritical},
+	FaultBatteryDischargeOverload: {"Battery discharge over current", SeverityMajor},
+	FaultOverCurrent:              {"Over current", SeverityCritical},
+	FaultBusVoltageLow:            {"Bus voltage is too low", SeverityCritical},
+	FaultInverterSoftStartFailed:  {"Inverter soft start failed", SeverityCritical},
+	FaultOutputDCVoltageHigh:      {"Over DC voltage in AC output", SeverityCritical},
+	FaultBatteryOpen:              {"Battery connection is open", SeverityMajor},
+	FaultCurrentSensorFailed:      {"Current sensor failed", SeverityCritical},
+	FaultOutputVoltageLow:         {"Output voltage is too low", SeverityCritical},
+	FaultPowerFeedback:            {"Power feedback protection", SeverityMajor},
+	FaultFirmwareMismatch:         {"Firmware version inconsistent", SeverityMajor},
+	FaultCurrentSharing:           {"Current sharing fault", SeverityMajor},
+	FaultCAN:                      {"CAN fault", SeverityMajor},
+	FaultHostLoss:                 {"Host loss", SeverityMajor},
+	FaultSynchronizationLoss:      {"Synchronization loss", SeverityMajor},
+	FaultBatteryVoltageMismatch:   {"Battery voltage detected different", SeverityMajor},
+	FaultACInputMismatch:          {"AC input voltage and frequency detected different", SeverityMajor},
+	FaultACOutputCurrentUnbalance: {"AC output current unbalance", SeverityMajor},
+	FaultOutputModeMismatch:       {"AC output mode setting is different", SeverityMajor},
+}
+
+// Returns the description of the fault as given in the manual.
+func (f FaultCode) Description() string {
+	if info, ok := faults[f]; ok {
+		return info.description
+	}
+	return fmt.Sprintf("Unknown fault %02d", uint8(f))
+}
+
+// Returns the severity of the fault, unknown faults are taken as major.
+func (f FaultCode) Severity() FaultSeverity {
+	if info, ok := faults[f]; ok {
+		return info.severity
+	}
+	return SeverityMajor
+}
@@ -0,0 +1,33 @@
+package axpert
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFaultCode(t *testing.T) {
+	tests := []struct {
+		code        FaultCode
+		description string
+		severity    FaultSeverity
+	}{
+		{code: FaultNone, description: "No fault", severity: SeverityNone},
+		{code: FaultOverloadTimeout, description: "Overload time out", severity: SeverityMinor},
+		{code: FaultBusVoltageLow, description: "Bus voltage is too low", severity: SeverityCritical},
+		{code: FaultHostLoss, description: "Host loss", severity: SeverityMajor},
+		{code: FaultCode(99), description: "Unknown fault 99", severity: SeverityMajor},
+	}
+	for _, tt := range tests {
+		if got := tt.code.Description(); got != tt.description {
+			t.Errorf("FaultCode(%d).Description() = %q, want %q", uint8(tt.code), got, tt.description)
+		}
+		if got := tt.code.Severity(); got != tt.severity {
+			t.Errorf("FaultCode(%d).Severity() = %v, want %v", uint8(tt.code), got, tt.severity)
+		}
+	}
+
+	info, err := parseParallelInfo(strings.Replace(simParallel, " B 00 ", " F 52 ", 1))
+	if err != nil || info.DeviceMode != ModeFault || info.FaultCode != FaultBusVoltageLow {
+		t.Errorf("parseParallelInfo() got = %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,374 @@
+package axpert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+const caret byte = 0x5e
+
+// Output source priorities by their PI18 value, Solar-Utility-Battery and
+// Solar-Battery-Utility
+var pi18OutputSourcePriorities = []OutputSourcePriority{OutputSolarFirst, OutputSBUFirst}
+
+var pi18ChargerSourcePriorities = []ChargerSourcePriority{ChargerSolarFirst, ChargerSolarAndUtility, ChargerSolarOnly}
+
+var pi18MachineTypes = []MachineType{OffGrid, GridTie}
+
+// Modes by PI18 mode, power on, standby, bypass, battery, fault and hybrid.
+// Hybrid reports as line mode, as PI30 units do.
+var pi18Modes = []Mode{ModePowerOn, ModeStandby, ModeLine, ModeBattery, ModeFault, ModeLine}
+
+// Flags in the order of the FLAG response, the letters A to H in PE and PD
+var pi18Flags = []DeviceFlag{Buzzer, OverloadBypass, DisplayTimeout, OverloadRestart, OverTemperatureRestart,
+	BacklightOn, PrimarySourceInterruptAlarm, FaultCodeRecord}
+
+// Warnings in the order of the FWS flags following the fault code
+var pi18Warnings = []DeviceWarning{WarnLineFail, WarnOPVShort, WarnOverTemperature, WarnFanLocked,
+	WarnBatteryVoltageHigh, WarnBatteryLowAlarm, WarnBatteryShutdown, WarnOverload, WarnEEPROMFault,
+	WarnPowerLimit, WarnPVVoltageHigh, WarnPVVoltageHigh2, WarnMPPTOverloadWarning, WarnMPPTOverloadWarning2,
+	WarnBatteryTooLowToCharge, WarnBatteryTooLowToCharge2}
+
+type pi18 struct{}
+
+func (pi18) Name() string {
+	return "PI18"
+}
+
+func (pi18) DeviceGeneralStatus(ctx context.Context, c connector.Connector) (*DeviceStatusParams, error) {
+	resp, err := pi18Query(ctx, c, "GS")
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := parsePI18Status(resp)
+	return params, parseError("GS", resp, err)
+}
+
+func (pi18) DeviceRatingInfo(ctx context.Context, c connector.Connector) (*RatingInfo, error) {
+	resp, err := pi18Query(ctx, c, "PIRI")
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := parsePI18RatingInfo(resp)
+	return info, parseError("PIRI", resp, err)
+}
+
+func (pi18) DeviceFlagStatus(ctx context.Context, c connector.Connector) (map[DeviceFlag]FlagStatus, error) {
+	resp, err := pi18Query(ctx, c, "FLAG")
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := parsePI18Flags(resp)
+	return flags, parseError("FLAG", resp, err)
+}
+
+func (pi18) WarningStatus(ctx context.Context, c connector.Connector) ([]DeviceWarning, error) {
+	resp, err := pi18Query(ctx, c, "FWS")
+	if err != nil {
+		return nil, err
+	}
+
+	warnings, err := parsePI18Warnings(resp)
+	return warnings, parseError("FWS", resp, err)
+}
+
+func (pi18) DeviceMode(ctx context.Context, c connector.Connector) (Mode, error) {
+	resp, err := pi18Query(ctx, c, "MOD")
+	if err != nil {
+		return 0, err
+	}
+
+	mode, err := strconv.Atoi(resp)
+	if err == nil && (mode < 0 || mode >= len(pi18Modes)) {
+		err = fmt.Errorf("unknown mode %d", mode)
+	}
+	if err != nil {
+		return 0, parseError("MOD", resp, err)
+	}
+	return pi18Modes[mode], nil
+}
+
+func (pi18) ParallelDeviceInfo(ctx context.Context, c connector.Connector, inverterIndex int) (*ParallelInfo, error) {
+	return nil, fmt.Errorf("%w: parallel info in PI18", ErrNotSupported)
+}
+
+func (pi18) EnableDeviceFlags(ctx context.Context, c connector.Connector, flags []DeviceFlag) error {
+	return setPI18Flags(ctx, c, flags, FlagEnabled)
+}
+
+func (pi18) DisableDeviceFlags(ctx context.Context, c connector.Connector, flags []DeviceFlag) error {
+	return setPI18Flags(ctx, c, flags, FlagDisabled)
+}
+
+func (pi18) SetOutputSourcePriority(ctx context.Context, c connector.Connector, priority OutputSourcePriority) error {
+	value := slices.Index(pi18OutputSourcePriorities, priority)
+	if value < 0 {
+		return fmt.Errorf("%w: output source priority %d in PI18", ErrNotSupported, priority)
+	}
+	return pi18Command(ctx, c, fmt.Sprintf("POP%d", value))
+}
+
+func (pi18) SetChargerSourcePriority(ctx context.Context, c connector.Connector, priority ChargerSourcePriority) error {
+	value := slices.Index(pi18ChargerSourcePriorities, priority)
+	if value < 0 {
+		return fmt.Errorf("%w: charger source priority %d in PI18", ErrNotSupported, priority)
+	}
+	return pi18Command(ctx, c, fmt.Sprintf("PCP0,%d", value))
+}
+
+func (pi18) SetMaxTotalChargingCurrent(ctx context.Context, c connector.Connector, current uint8, parallelNumber uint8) error {
+	return pi18Command(ctx, c, fmt.Sprintf("MCHGC%d,%03d", parallelNumber, current))
+}
+
+func (pi18) SetMaxUtilityChargingCurrent(ctx context.Context, c connector.Connector, current uint8) error {
+	return pi18Command(ctx, c, fmt.Sprintf("MUCHGC0,%03d", current))
+}
+
+func (pi18) SetBatteryCutoffVoltage(ctx context.Context, c connector.Connector, voltage float32) error {
+	return pi18Command(ctx, c, fmt.Sprintf("PSDV%03d", int(math.Round(float64(voltage)*10))))
+}
+
+func (pi18) SetBatteryType(ctx context.Context, c connector.Connector, batteryType BatteryType) error {
+	return pi18Command(ctx, c, fmt.Sprintf("PBT%d", batteryType))
+}
+
+// Sets the flags one at a time, PI18 takes a single flag per command.
+func setPI18Flags(ctx context.Context, c connector.Connector, flags []DeviceFlag, status FlagStatus) error {
+	for _, flag := range flags {
+		i := slices.Index(pi18Flags, flag)
+		if i < 0 {
+			return fmt.Errorf("%w: flag %d in PI18", ErrNotSupported, flag)
+		}
+		err := pi18Command(ctx, c, fmt.Sprintf("P%c%c", status.char(), 'A'+i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends a ^P query, returns the data of the ^D response or ErrNotSupported
+// if the inverter answers ^0.
+func pi18Query(ctx context.Context, c connector.Connector, query string) (string, error) {
+	resp, err := pi18Request(ctx, c, "^P", query)
+	if err != nil {
+		return "", err
+	}
+	if resp == "^0" {
+		return "", fmt.Errorf("%w: %v", ErrNotSupported, query)
+	}
+
+	data, ok := strings.CutPrefix(resp, "^D")
+	if !ok || len(data) < 3 {
+		return "", fmt.Errorf("%w: invalid response %q to %s", ErrFraming, resp, query)
+	}
+	return data[3:], nil
+}
+
+// Sends a ^S command, returns ErrNAK if the inverter answers ^0.
+func pi18Command(ctx context.Context, c connector.Connector, command string) error {
+	resp, err := pi18Request(ctx, c, "^S", command)
+	if err != nil {
+		return err
+	}
+
+	switch resp {
+	case "^1":
+		return nil
+	case "^0":
+		return fmt.Errorf("%w: %v", ErrNAK, command)
+	}
+	return fmt.Errorf("%w: invalid response %q to %s", ErrFraming, resp, command)
+}
+
+// Frames the command with its prefix and length, which counts the command,
+// CRC and CR. Returns the response without CRC and CR.
+func pi18Request(ctx context.Context, c connector.Connector, prefix string, command string) (string, error) {
+	readBytes, err := transfer(ctx, c, fmt.Sprintf("%s%03d%s", prefix, len(command)+3, command))
+	if err != nil {
+		return "", err
+	}
+
+	readLen := len(readBytes)
+	if readLen < 5 || readBytes[0] != caret {
+		return "", fmt.Errorf("%w: invalid response start %q", ErrFraming, readBytes)
+	}
+	if readBytes[readLen-1] != cr {
+		return "", fmt.Errorf("%w: invalid response end %x", ErrFraming, readBytes[readLen-1])
+	}
+	readCrc := readBytes[readLen-3 : readLen-1]
+	calcCrc := crc(readBytes[:readLen-3])
+	if !bytes.Equal(readCrc, calcCrc) {
+		return "", fmt.Errorf("%w, received %v, expected %v", ErrChecksum, readCrc, calcCrc)
+	}
+
+	return string(readBytes[:readLen-3]), nil
+}
+
+// Reads the comma separated fields of a PI18 response. Invalid fields yield
+// zero and set err, so that a response can be decoded without checking
+// every field.
+type pi18Fields struct {
+	parts []string
+	err   error
+}
+
+func newPI18Fields(resp string, count int) (*pi18Fields, error) {
+	parts := strings.Split(resp, ",")
+	if len(parts) < count {
+		return nil, fmt.Errorf("%w: %s", ErrShortResponse, resp)
+	}
+	return &pi18Fields{parts: parts}, nil
+}
+
+func (f *pi18Fields) int(i int) int {
+	v, err := strconv.Atoi(f.parts[i])
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return v
+}
+
+// Returns a value sent in tenths, e.g. 0.1V.
+func (f *pi18Fields) tenths(i int) float32 {
+	return float32(f.int(i)) / 10.0
+}
+
+// Returns the value of an enumerated field, which must be below n.
+func (f *pi18Fields) enum(i int, n int) int {
+	v := f.int(i)
+	if (v < 0 || v >= n) && f.err == nil {
+		f.err = fmt.Errorf("field %d out of range: %d", i, v)
+	}
+	return max(0, min(v, n-1))
+}
+
+func parsePI18Status(resp string) (*DeviceStatusParams, error) {
+	f, err := newPI18Fields(resp, 28)
+	if err != nil {
+		return nil, err
+	}
+
+	params := DeviceStatusParams{
+		GridVoltage:             f.tenths(0),
+		GridFrequency:           f.tenths(1),
+		ACOutputVoltage:         f.tenths(2),
+		ACOutputFrequency:       f.tenths(3),
+		ACOutputApparentPower:   f.int(4),
+		ACOutputActivePower:     f.int(5),
+		OutputLoadPercent:       f.int(6),
+		BatteryVoltage:          f.tenths(7),
+		BatteryVoltageSCC1:      f.tenths(8),
+		BatteryVoltageSCC2:      f.tenths(9),
+		BatteryDischargeCurrent: f.int(10),
+		BatteryChargingCurrent:  f.int(11),
+		BatteryCapacity:         f.int(12),
+		HeatSinkTemperature:     f.int(13),
+		// 14 and 15 are the MPPT temperatures
+		PVChargingPower1:    f.int(16),
+		PVChargingPower2:    f.int(17),
+		PVInputVoltage1:     f.tenths(18),
+		PVInputVoltage2:     f.tenths(19),
+		ConfigStatusChanged: f.int(20) == 1,
+		// MPPT status 0 abnormal, 1 not charging, 2 charging
+		SCC1ChargingOn: f.int(21) == 2,
+		SCC2ChargingOn: f.int(22) == 2,
+		LoadOn:         f.int(23) == 1,
+		// Battery power direction 1 charging, DC/AC power direction 1 AC/DC
+		ChargingOn:   f.int(24) == 1,
+		ACChargingOn: f.int(25) == 1,
+	}
+	params.PVTotalChargingPower = params.PVChargingPower1 + params.PVChargingPower2
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &params, nil
+}
+
+func parsePI18RatingInfo(resp string) (*RatingInfo, error) {
+	f, err := newPI18Fields(resp, 23)
+	if err != nil {
+		return nil, err
+	}
+
+	info := RatingInfo{
+		GridRatingVoltage:           f.tenths(0),
+		GridRatingCurrent:           f.tenths(1),
+		ACOutputRatingVoltage:       f.tenths(2),
+		ACOutputRatingFrequency:     f.tenths(3),
+		ACOutputRatingCurrent:       f.tenths(4),
+		ACOutputRatingApparentPower: f.int(5),
+		ACOutputRatingActivePower:   f.int(6),
+		BatteryRatingVoltage:        f.tenths(7),
+		BatteryRechargeVoltage:      f.tenths(8),
+		BatteryRedischargeVoltage:   f.tenths(9),
+		BatteryUnderVoltage:         f.tenths(10),
+		BatteryBulkVoltage:          f.tenths(11),
+		BatteryFloatVoltage:         f.tenths(12),
+		BatteryType:                 BatteryType(f.enum(13, 3)),
+		MaxACChargingCurrent:        f.int(14),
+		MaxChargingCurrent:          f.int(15),
+		InputVoltageRange:           VoltageRange(f.enum(16, 2)),
+		OutputSourcePriority:        pi18OutputSourcePriorities[f.enum(17, len(pi18OutputSourcePriorities))],
+		ChargerSourcePriority:       pi18ChargerSourcePriorities[f.enum(18, len(pi18ChargerSourcePriorities))],
+		ParallelMaxNumber:           f.int(19),
+		MachineType:                 pi18MachineTypes[f.enum(20, len(pi18MachineTypes))],
+		Topology:                    Topology(f.enum(21, 2)),
+		OutputMode:                  OutputMode(f.enum(22, 5)),
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &info, nil
+}
+
+func parsePI18Flags(resp string) (map[DeviceFlag]FlagStatus, error) {
+	f, err := newPI18Fields(resp, len(pi18Flags))
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[DeviceFlag]FlagStatus)
+	for i, flag := range pi18Flags {
+		flags[flag] = FlagStatus(f.enum(i, 2))
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return flags, nil
+}
+
+func parsePI18Warnings(resp string) ([]DeviceWarning, error) {
+	f, err := newPI18Fields(resp, 1+len(pi18Warnings))
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := make([]DeviceWarning, 0)
+	if f.int(0) != 0 {
+		warnings = append(warnings, WarnInverterFault)
+	}
+	for i, warning := range pi18Warnings {
+		if f.enum(i+1, 2) == 1 {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return warnings, nil
+}
@@ -0,0 +1,203 @@
+package axpert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// Responses of a PI18 inverter charging from PV in battery mode
+var pi18Responses = map[string]string{
+	"PI":   "18",
+	"GS":   "2301,500,2302,500,0460,0400,009,528,527,000,000,012,085,035,040,000,0850,0000,1050,0000,0,2,0,1,1,0,0,0",
+	"PIRI": "2300,217,2300,500,217,5000,5000,480,500,530,440,576,552,2,030,120,0,1,1,6,0,0,0,1,2,0",
+	"FLAG": "1,0,1,0,1,1,1,0,0",
+	"FWS":  "00,0,0,0,1,0,0,0,0,0,0,0,0,0,0,0,0",
+	"MOD":  "03",
+}
+
+func pi18Frame(resp string) []byte {
+	frame := []byte(resp)
+	frame = append(frame, crc(frame)...)
+	return append(frame, cr)
+}
+
+// Returns a connector to a PI18 inverter, which ignores PI30 requests and
+// records the commands it receives.
+func pi18Inverter(commands *[]string) connector.Connector {
+	return connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		req := string(request[:len(request)-3])
+		if query, ok := strings.CutPrefix(req, "^P"); ok {
+			if resp, ok := pi18Responses[query[3:]]; ok {
+				return pi18Frame(fmt.Sprintf("^D%03d%s", len(resp)+3, resp))
+			}
+			return pi18Frame("^0")
+		}
+		if command, ok := strings.CutPrefix(req, "^S"); ok {
+			*commands = append(*commands, command[3:])
+			return pi18Frame("^1")
+		}
+		return nil
+	}))
+}
+
+func TestDetectProtocol(t *testing.T) {
+	p, err := DetectProtocol(NewSimulator().Connector())
+	if err != nil || p != PI30 {
+		t.Errorf("DetectProtocol() got = %v, %v, want PI30", p, err)
+	}
+
+	p, err = DetectProtocol(pi18Inverter(new([]string)))
+	if err != nil || p != PI18 {
+		t.Errorf("DetectProtocol() got = %v, %v, want PI18", p, err)
+	}
+
+	c := connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		return simFrame("PI17")
+	}))
+	_, err = DetectProtocol(c)
+	if !errors.Is(err, ErrUnknownProtocol) {
+		t.Errorf("DetectProtocol() error = %v, want %v", err, ErrUnknownProtocol)
+	}
+}
+
+// Passes requests to a connector, but leaves QPI unanswered until the read
+// is given up.
+type silentQPIConnector struct {
+	connector.Connector
+	qpi bool
+}
+
+func (sc *silentQPIConnector) Read(terminator byte) ([]byte, error) {
+	return sc.ReadContext(context.Background(), terminator)
+}
+
+func (sc *silentQPIConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	if sc.qpi {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return sc.Connector.Read(terminator)
+}
+
+func (sc *silentQPIConnector) Write(bytes []byte) error {
+	sc.qpi = strings.HasPrefix(string(bytes), "QPI")
+	if sc.qpi {
+		return nil
+	}
+	return sc.Connector.Write(bytes)
+}
+
+func (sc *silentQPIConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	return sc.Write(bytes)
+}
+
+func TestDetectProtocolSilentQPI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	p, err := DetectProtocolContext(ctx, &silentQPIConnector{Connector: pi18Inverter(new([]string))})
+	if err != nil || p != PI18 {
+		t.Errorf("DetectProtocolContext() got = %v, %v, want PI18", p, err)
+	}
+}
+
+func TestPI18(t *testing.T) {
+	var commands []string
+	c := pi18Inverter(&commands)
+	ctx := context.Background()
+
+	status, err := PI18.DeviceGeneralStatus(ctx, c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if status.GridVoltage != 230.1 || status.BatteryVoltage != 52.8 || status.BatteryChargingCurrent != 12 ||
+		status.BatteryCapacity != 85 || status.PVChargingPower1 != 850 || status.PVInputVoltage1 != 105 ||
+		!status.SCC1ChargingOn || !status.LoadOn || !status.ChargingOn || status.ACChargingOn {
+		t.Error("unexpected status ", *status)
+	}
+
+	rating, err := PI18.DeviceRatingInfo(ctx, c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if rating.ACOutputRatingActivePower != 5000 || rating.BatteryBulkVoltage != 57.6 || rating.BatteryType != User ||
+		rating.OutputSourcePriority != OutputSBUFirst || rating.ChargerSourcePriority != ChargerSolarAndUtility ||
+		rating.MachineType != OffGrid {
+		t.Error("unexpected rating info ", *rating)
+	}
+
+	flags, err := PI18.DeviceFlagStatus(ctx, c)
+	if err != nil || flags[Buzzer] != FlagEnabled || flags[OverloadBypass] != FlagDisabled || flags[FaultCodeRecord] != FlagDisabled {
+		t.Errorf("DeviceFlagStatus() got = %v, %v", flags, err)
+	}
+
+	warnings, err := PI18.WarningStatus(ctx, c)
+	if err != nil || len(warnings) != 1 || warnings[0] != WarnFanLocked {
+		t.Errorf("WarningStatus() got = %v, %v", warnings, err)
+	}
+
+	mode, err := PI18.DeviceMode(ctx, c)
+	if err != nil || mode != ModeBattery {
+		t.Errorf("DeviceMode() got = %v, %v, want battery mode", mode, err)
+	}
+
+	_, err = PI18.ParallelDeviceInfo(ctx, c, 0)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ParallelDeviceInfo() error = %v, want %v", err, ErrNotSupported)
+	}
+
+	err = errors.Join(
+		PI18.SetOutputSourcePriority(ctx, c, OutputSolarFirst),
+		PI18.SetChargerSourcePriority(ctx, c, ChargerSolarOnly),
+		PI18.SetMaxTotalChargingCurrent(ctx, c, 60, 0),
+		PI18.SetMaxUtilityChargingCurrent(ctx, c, 30),
+		PI18.SetBatteryCutoffVoltage(ctx, c, 44.5),
+		PI18.SetBatteryType(ctx, c, AGM),
+		PI18.DisableDeviceFlags(ctx, c, []DeviceFlag{Buzzer, BacklightOn}),
+	)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	want := []string{"POP0", "PCP0,2", "MCHGC0,060", "MUCHGC0,030", "PSDV445", "PBT0", "PDA", "PDF"}
+	if strings.Join(commands, " ") != strings.Join(want, " ") {
+		t.Errorf("commands got = %v, want %v", commands, want)
+	}
+
+	err = PI18.SetOutputSourcePriority(ctx, c, OutputUtilityFirst)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetOutputSourcePriority() error = %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func Test_parsePI18Malformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func() error
+		want  error
+	}{
+		{name: "Short status", parse: func() error { _, err := parsePI18Status("2301,500"); return err }, want: ErrShortResponse},
+		{name: "Short flags", parse: func() error { _, err := parsePI18Flags("1,0"); return err }, want: ErrShortResponse},
+		{name: "Invalid number", parse: func() error {
+			_, err := parsePI18RatingInfo(strings.Replace(pi18Responses["PIRI"], "217", "x", 1))
+			return err
+		}},
+		{name: "Unknown priority", parse: func() error {
+			_, err := parsePI18RatingInfo(strings.Replace(pi18Responses["PIRI"], ",0,1,1,6,", ",0,5,1,6,", 1))
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.parse()
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("got error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
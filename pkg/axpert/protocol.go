@@ -2,10 +2,12 @@ package axpert
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/howeyc/crc16"
 
@@ -20,6 +22,10 @@ const (
 
 // Retrieves connectors for all Axpert inverters connected through USB.
 func GetUSBInverters() (cs []*connector.USBConnector, err error) {
+	return GetUSBInvertersContext(context.Background())
+}
+
+func GetUSBInvertersContext(ctx context.Context) (cs []*connector.USBConnector, err error) {
 	paths, err := connector.GetUSBPaths()
 	if err != nil {
 		return nil, err
@@ -33,7 +39,7 @@ func GetUSBInverters() (cs []*connector.USBConnector, err error) {
 			return nil, err
 		}
 
-		_, err = SerialNo(conn)
+		_, err = SerialNoContext(ctx, conn)
 		if err != nil {
 			conn.Close()
 			continue
@@ -50,12 +56,20 @@ func GetUSBInverters() (cs []*connector.USBConnector, err error) {
 }
 
 func ProtocolId(c connector.Connector) (id string, err error) {
-	id, err = sendRequest(c, "QPI")
+	return ProtocolIdContext(context.Background(), c)
+}
+
+func ProtocolIdContext(ctx context.Context, c connector.Connector) (id string, err error) {
+	id, err = sendQuery(ctx, c, "QPI")
 	return
 }
 
 func SerialNo(c connector.Connector) (serialNo string, err error) {
-	serialNo, err = sendRequest(c, "QID")
+	return SerialNoContext(context.Background(), c)
+}
+
+func SerialNoContext(ctx context.Context, c connector.Connector) (serialNo string, err error) {
+	serialNo, err = sendQuery(ctx, c, "QID")
 	return
 }
 
@@ -65,57 +79,78 @@ type FirmwareVersion struct {
 }
 
 func InverterFirmwareVersion(c connector.Connector) (version *FirmwareVersion, err error) {
-	resp, err := sendRequest(c, "QVFW")
+	return InverterFirmwareVersionContext(context.Background(), c)
+}
+
+func InverterFirmwareVersionContext(ctx context.Context, c connector.Connector) (version *FirmwareVersion, err error) {
+	resp, err := sendQuery(ctx, c, "QVFW")
 	if err != nil {
 		return
 	}
 
 	version, err = parseFirmwareVersion(resp, "VERFW")
+	err = parseError("QVFW", resp, err)
 	return
 }
 
 func SCC1FirmwareVersion(c connector.Connector) (version *FirmwareVersion, err error) {
-	resp, err := sendRequest(c, "QVFW2")
+	return SCC1FirmwareVersionContext(context.Background(), c)
+}
+
+func SCC1FirmwareVersionContext(ctx context.Context, c connector.Connector) (version *FirmwareVersion, err error) {
+	resp, err := sendQuery(ctx, c, "QVFW2")
 	if err != nil {
 		return
 	}
 
 	version, err = parseFirmwareVersion(resp, "VERFW2")
+	err = parseError("QVFW2", resp, err)
 	return
 }
 
 func SCC2FirmwareVersion(c connector.Connector) (version *FirmwareVersion, err error) {
-	resp, err := sendRequest(c, "QVFW3")
+	return SCC2FirmwareVersionContext(context.Background(), c)
+}
+
+func SCC2FirmwareVersionContext(ctx context.Context, c connector.Connector) (version *FirmwareVersion, err error) {
+	resp, err := sendQuery(ctx, c, "QVFW3")
 	if err != nil {
 		return
 	}
 
 	version, err = parseFirmwareVersion(resp, "VERFW3")
+	err = parseError("QVFW3", resp, err)
 	return
 }
 
 func SCC3FirmwareVersion(c connector.Connector) (version *FirmwareVersion, err error) {
-	resp, err := sendRequest(c, "QVFW4")
+	return SCC3FirmwareVersionContext(context.Background(), c)
+}
+
+func SCC3FirmwareVersionContext(ctx context.Context, c connector.Connector) (version *FirmwareVersion, err error) {
+	resp, err := sendQuery(ctx, c, "QVFW4")
 	if err != nil {
 		return
 	}
 
 	version, err = parseFirmwareVersion(resp, "VERFW4")
+	err = parseError("QVFW4", resp, err)
 	return
 }
 
 func CVModeChargingTime(c connector.Connector) (chargingTime uint8, err error) {
+	return CVModeChargingTimeContext(context.Background(), c)
+}
+
+func CVModeChargingTimeContext(ctx context.Context, c connector.Connector) (chargingTime uint8, err error) {
 	const query = "QCVT"
-	resp, err := sendRequest(c, query)
+	resp, err := sendQuery(ctx, c, query)
 	if err != nil {
 		return
 	}
-	if resp == "NAK" {
-		err = fmt.Errorf("query not supported, %v", query)
-		return
-	}
 	b, err := strconv.ParseUint(resp, 10, 8)
 	if err != nil {
+		err = parseError(query, resp, err)
 		return
 	}
 	chargingTime = uint8(b)
@@ -123,17 +158,18 @@ func CVModeChargingTime(c connector.Connector) (chargingTime uint8, err error) {
 }
 
 func DeviceChargingStage(c connector.Connector) (chargingStage ChargingStage, err error) {
+	return DeviceChargingStageContext(context.Background(), c)
+}
+
+func DeviceChargingStageContext(ctx context.Context, c connector.Connector) (chargingStage ChargingStage, err error) {
 	const query = "QCST"
-	resp, err := sendRequest(c, query)
+	resp, err := sendQuery(ctx, c, query)
 	if err != nil {
 		return
 	}
-	if resp == "NAK" {
-		err = fmt.Errorf("query not supported, %v", query)
-		return
-	}
 	b, err := strconv.ParseUint(resp, 10, 8)
 	if err != nil {
+		err = parseError(query, resp, err)
 		return
 	}
 	chargingStage = ChargingStage(b)
@@ -141,17 +177,18 @@ func DeviceChargingStage(c connector.Connector) (chargingStage ChargingStage, er
 }
 
 func DeviceOutputMode(c connector.Connector) (outputMode OutputMode, err error) {
+	return DeviceOutputModeContext(context.Background(), c)
+}
+
+func DeviceOutputModeContext(ctx context.Context, c connector.Connector) (outputMode OutputMode, err error) {
 	query := "QOPM"
-	resp, err := sendRequest(c, query)
+	resp, err := sendQuery(ctx, c, query)
 	if err != nil {
 		return
 	}
-	if resp == "NAK" {
-		err = fmt.Errorf("query not supported, %v", query)
-		return
-	}
 	b, err := strconv.ParseUint(resp, 10, 8)
 	if err != nil {
+		err = parseError(query, resp, err)
 		return
 	}
 	outputMode = OutputMode(b)
@@ -159,7 +196,11 @@ func DeviceOutputMode(c connector.Connector) (outputMode OutputMode, err error)
 }
 
 func DSPBootstrapped(c connector.Connector) (hasBootstrap bool, err error) {
-	bootstrap, err := sendRequest(c, "QBOOT")
+	return DSPBootstrappedContext(context.Background(), c)
+}
+
+func DSPBootstrappedContext(ctx context.Context, c connector.Connector) (hasBootstrap bool, err error) {
+	bootstrap, err := sendQuery(ctx, c, "QBOOT")
 	if err != nil {
 		return
 	}
@@ -168,22 +209,38 @@ func DSPBootstrapped(c connector.Connector) (hasBootstrap bool, err error) {
 }
 
 func MaxSolarChargingCurrent(c connector.Connector) (chargingCurrent string, err error) {
-	chargingCurrent, err = sendRequest(c, "QMSCHGCR")
+	return MaxSolarChargingCurrentContext(context.Background(), c)
+}
+
+func MaxSolarChargingCurrentContext(ctx context.Context, c connector.Connector) (chargingCurrent string, err error) {
+	chargingCurrent, err = sendQuery(ctx, c, "QMSCHGCR")
 	return
 }
 
 func MaxUtilityChargingCurrent(c connector.Connector) (chargingCurrent string, err error) {
-	chargingCurrent, err = sendRequest(c, "QMUCHGCR")
+	return MaxUtilityChargingCurrentContext(context.Background(), c)
+}
+
+func MaxUtilityChargingCurrentContext(ctx context.Context, c connector.Connector) (chargingCurrent string, err error) {
+	chargingCurrent, err = sendQuery(ctx, c, "QMUCHGCR")
 	return
 }
 
 func MaxTotalChargingCurrent(c connector.Connector) (chargingCurrent string, err error) {
-	chargingCurrent, err = sendRequest(c, "QMCHGCR")
+	return MaxTotalChargingCurrentContext(context.Background(), c)
+}
+
+func MaxTotalChargingCurrentContext(ctx context.Context, c connector.Connector) (chargingCurrent string, err error) {
+	chargingCurrent, err = sendQuery(ctx, c, "QMCHGCR")
 	return
 }
 
 func DefaultSettings(c connector.Connector) (defaultSettings string, err error) {
-	defaultSettings, err = sendRequest(c, "QDI")
+	return DefaultSettingsContext(context.Background(), c)
+}
+
+func DefaultSettingsContext(ctx context.Context, c connector.Connector) (defaultSettings string, err error) {
+	defaultSettings, err = sendQuery(ctx, c, "QDI")
 	return
 }
 
@@ -307,12 +364,17 @@ type RatingInfo struct {
 }
 
 func DeviceRatingInfo(c connector.Connector) (ratingInfo *RatingInfo, err error) {
-	resp, err := sendRequest(c, "QPIRI")
+	return DeviceRatingInfoContext(context.Background(), c)
+}
+
+func DeviceRatingInfoContext(ctx context.Context, c connector.Connector) (ratingInfo *RatingInfo, err error) {
+	resp, err := sendQuery(ctx, c, "QPIRI")
 	if err != nil {
 		return
 	}
 
 	ratingInfo, err = parseRatingInfo(resp)
+	err = parseError("QPIRI", resp, err)
 	return
 }
 
@@ -377,12 +439,17 @@ func (f DeviceFlag) char() byte {
 }
 
 func DeviceFlagStatus(c connector.Connector) (flags map[DeviceFlag]FlagStatus, err error) {
-	resp, err := sendRequest(c, "QFLAG")
+	return DeviceFlagStatusContext(context.Background(), c)
+}
+
+func DeviceFlagStatusContext(ctx context.Context, c connector.Connector) (flags map[DeviceFlag]FlagStatus, err error) {
+	resp, err := sendQuery(ctx, c, "QFLAG")
 	if err != nil {
 		return
 	}
 
 	flags, err = parseDeviceFlags(resp)
+	err = parseError("QFLAG", resp, err)
 	return
 }
 
@@ -432,27 +499,38 @@ type DeviceStatusParams struct {
 }
 
 func DeviceGeneralStatus(c connector.Connector) (params *DeviceStatusParams, err error) {
-	resp, err := sendRequest(c, "QPIGS")
+	return DeviceGeneralStatusContext(context.Background(), c)
+}
+
+func DeviceGeneralStatusContext(ctx context.Context, c connector.Connector) (params *DeviceStatusParams, err error) {
+	resp, err := sendQuery(ctx, c, "QPIGS")
 	if err != nil {
 		return
 	}
 
 	params, err = parseDeviceStatusParams(resp)
+	err = parseError("QPIGS", resp, err)
 
 	return
 }
 
 func DeviceGeneralStatus2(c connector.Connector, p *DeviceStatusParams) (params *DeviceStatusParams, err error) {
-	resp, err := sendRequest(c, "QPIGS2")
+	return DeviceGeneralStatus2Context(context.Background(), c, p)
+}
+
+func DeviceGeneralStatus2Context(ctx context.Context, c connector.Connector, p *DeviceStatusParams) (params *DeviceStatusParams, err error) {
+	resp, err := sendQuery(ctx, c, "QPIGS2")
 	if err != nil {
 		return
 	}
 
+	params = &DeviceStatusParams{}
 	if p != nil {
 		params = p
 	}
 
 	params, err = parseDeviceStatusParams2(resp, params)
+	err = parseError("QPIGS2", resp, err)
 
 	return
 }
@@ -470,8 +548,8 @@ type ParallelInfo struct {
 	DeviceIndex                int
 	DeviceExists               bool
 	SerialNumber               string
-	DeviceMode                 string
-	FaultCode                  uint8
+	DeviceMode                 Mode
+	FaultCode                  FaultCode
 	GridVoltage                float32
 	GridFrequency              float32
 	ACOutputVoltage            float32
@@ -497,6 +575,7 @@ type ParallelInfo struct {
 	MaxChargerRange            int
 	MaxACChargerCurrent        int
 	BatteryDischargeCurrent    int
+	PVChargingCurrent          int
 	PV1InputCurrent            int
 	PV1InputVoltage            float32
 	PV1ChargingPower           int
@@ -515,31 +594,104 @@ type ParallelInfo struct {
 }
 
 func ParallelDeviceInfo(c connector.Connector, inverterIndex int) (info *ParallelInfo, err error) {
-	resp, err := sendRequest(c, fmt.Sprintf("QPGS%d", inverterIndex))
+	return ParallelDeviceInfoContext(context.Background(), c, inverterIndex)
+}
+
+func ParallelDeviceInfoContext(ctx context.Context, c connector.Connector, inverterIndex int) (info *ParallelInfo, err error) {
+	resp, err := sendQuery(ctx, c, fmt.Sprintf("QPGS%d", inverterIndex))
 	if err != nil {
 		return
 	}
 	info, err = parseParallelInfo(resp)
 	if err != nil {
+		err = parseError(fmt.Sprintf("QPGS%d", inverterIndex), resp, err)
 		return
 	}
 
-	// This always fails/blocks indefinitely/times out
-	//resp, err = sendRequest(c, fmt.Sprintf("QP2GS%d", inverterIndex))
-	//if err != nil {
-	//	return
-	//}
-	//info, err = parseParallelPVInfo(resp, info)
-	//if err != nil {
-	//	return
-	//}
-
 	info.DeviceIndex = inverterIndex
 	return
 }
 
-func DeviceMode(c connector.Connector) (mode string, err error) {
-	mode, err = sendRequest(c, "QMOD")
+// Time to wait for the QP2GS response, inverters that do not implement it
+// may never answer
+const parallelPVInfoTimeout = 2 * time.Second
+
+// Adds the PV1 current and power, the PV2 and PV3 trackers and the charger
+// status of QP2GS to the QPGS result p. Only models with more than one
+// tracker implement QP2GS, others answer NAK or not at all, which gives
+// ErrNotSupported or ErrTimeout. p is left unchanged on errors, when it is
+// nil a new ParallelInfo with only the QP2GS fields is returned.
+func ParallelDeviceInfo2(c connector.Connector, inverterIndex int, p *ParallelInfo) (info *ParallelInfo, err error) {
+	return ParallelDeviceInfo2Context(context.Background(), c, inverterIndex, p)
+}
+
+func ParallelDeviceInfo2Context(ctx context.Context, c connector.Connector, inverterIndex int, p *ParallelInfo) (info *ParallelInfo, err error) {
+	pvCtx, cancel := context.WithTimeout(ctx, parallelPVInfoTimeout)
+	defer cancel()
+	query := fmt.Sprintf("QP2GS%d", inverterIndex)
+	resp, err := sendQuery(pvCtx, c, query)
+	if err != nil {
+		return p, err
+	}
+
+	var pv ParallelInfo
+	if p != nil {
+		pv = *p
+	}
+	_, err = parseParallelPVInfo(resp, &pv)
+	if err != nil {
+		return p, parseError(query, resp, err)
+	}
+	if p == nil {
+		return &pv, nil
+	}
+	*p = pv
+	return p, nil
+}
+
+//go:generate enumer -type=Mode -json -text
+type Mode uint8
+
+const (
+	ModePowerOn Mode = iota
+	ModeStandby
+	ModeLine
+	ModeBattery
+	ModeFault
+	ModePowerSaving
+	ModeShutdown
+)
+
+// Letters of the modes in QMOD and QPGS responses
+const modeChars = "PSLBFHD"
+
+func (m Mode) char() byte {
+	if int(m) < len(modeChars) {
+		return modeChars[m]
+	}
+	return 0
+}
+
+func parseMode(resp string) (Mode, error) {
+	i := strings.Index(modeChars, resp)
+	if len(resp) != 1 || i < 0 {
+		return 0, fmt.Errorf("unknown mode %q", resp)
+	}
+	return Mode(i), nil
+}
+
+func DeviceMode(c connector.Connector) (mode Mode, err error) {
+	return DeviceModeContext(context.Background(), c)
+}
+
+func DeviceModeContext(ctx context.Context, c connector.Connector) (mode Mode, err error) {
+	resp, err := sendQuery(ctx, c, "QMOD")
+	if err != nil {
+		return
+	}
+
+	mode, err = parseMode(resp)
+	err = parseError("QMOD", resp, err)
 	return
 }
 
@@ -588,30 +740,36 @@ const (
 )
 
 func WarningStatus(c connector.Connector) (warnings []DeviceWarning, err error) {
-	status, err := sendRequest(c, "QPIWS")
+	return WarningStatusContext(context.Background(), c)
+}
+
+func WarningStatusContext(ctx context.Context, c connector.Connector) (warnings []DeviceWarning, err error) {
+	status, err := sendQuery(ctx, c, "QPIWS")
 	if err != nil {
 		return
 	}
 
 	warnings, err = parseWarnings(status)
+	err = parseError("QPIWS", status, err)
 	return
 }
 
 func EnableDeviceFlags(c connector.Connector, flags []DeviceFlag) error {
+	return EnableDeviceFlagsContext(context.Background(), c, flags)
+}
+
+func EnableDeviceFlagsContext(ctx context.Context, c connector.Connector, flags []DeviceFlag) error {
 	command := formatDeviceFlags(flags, FlagEnabled)
-	resp, err := sendRequest(c, command)
-	if err != nil {
-		return err
-	}
-	if resp == "NAK" {
-		return fmt.Errorf("command not acknowledged, %v", command)
-	}
-	return nil
+	return sendCommand(ctx, c, command)
 }
 
 func DisableDeviceFlags(c connector.Connector, flags []DeviceFlag) error {
+	return DisableDeviceFlagsContext(context.Background(), c, flags)
+}
+
+func DisableDeviceFlagsContext(ctx context.Context, c connector.Connector, flags []DeviceFlag) error {
 	command := formatDeviceFlags(flags, FlagDisabled)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func formatDeviceFlags(flags []DeviceFlag, status FlagStatus) string {
@@ -626,39 +784,67 @@ func formatDeviceFlags(flags []DeviceFlag, status FlagStatus) string {
 }
 
 func SetOutputSourcePriority(c connector.Connector, priority OutputSourcePriority) error {
+	return SetOutputSourcePriorityContext(context.Background(), c, priority)
+}
+
+func SetOutputSourcePriorityContext(ctx context.Context, c connector.Connector, priority OutputSourcePriority) error {
 	command := fmt.Sprintf("POP%02d", priority)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetDefaultSettings(c connector.Connector) error {
+	return SetDefaultSettingsContext(context.Background(), c)
+}
+
+func SetDefaultSettingsContext(ctx context.Context, c connector.Connector) error {
 	command := "PF"
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetMaxTotalChargingCurrent(c connector.Connector, current uint8, parallelNumber uint8) error {
+	return SetMaxTotalChargingCurrentContext(context.Background(), c, current, parallelNumber)
+}
+
+func SetMaxTotalChargingCurrentContext(ctx context.Context, c connector.Connector, current uint8, parallelNumber uint8) error {
 	command := fmt.Sprintf("MCHGC%1d%03d", parallelNumber, current)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetParallelMaxTotalChargingCurrent(c connector.Connector, current uint8) error {
+	return SetParallelMaxTotalChargingCurrentContext(context.Background(), c, current)
+}
+
+func SetParallelMaxTotalChargingCurrentContext(ctx context.Context, c connector.Connector, current uint8) error {
 	command := fmt.Sprintf("MNCHGC%03d", current)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 
 }
 
 func SetMaxUtilityChargingCurrent(c connector.Connector, current uint8) error {
+	return SetMaxUtilityChargingCurrentContext(context.Background(), c, current)
+}
+
+func SetMaxUtilityChargingCurrentContext(ctx context.Context, c connector.Connector, current uint8) error {
 	command := fmt.Sprintf("MUCHGC%03d", current)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetMaxSolarChargingCurrent(c connector.Connector, current uint8) error {
+	return SetMaxSolarChargingCurrentContext(context.Background(), c, current)
+}
+
+func SetMaxSolarChargingCurrentContext(ctx context.Context, c connector.Connector, current uint8) error {
 	command := fmt.Sprintf("MSCHGC%03d", current)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetOutputRatingFrequency(c connector.Connector, frequency uint8) error {
+	return SetOutputRatingFrequencyContext(context.Background(), c, frequency)
+}
+
+func SetOutputRatingFrequencyContext(ctx context.Context, c connector.Connector, frequency uint8) error {
 	command := fmt.Sprintf("F%02d", frequency)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 // Valid values are
@@ -666,8 +852,12 @@ func SetOutputRatingFrequency(c connector.Connector, frequency uint8) error {
 // 24V unit: 22V/22.5V/23V/23.5V/24V/24.5V/25V/25.5V
 // 48V unit: 44V/45V/46V/47V/48V/49V/50V/51V
 func SetBatteryRechargeVoltage(c connector.Connector, voltage float32) error {
+	return SetBatteryRechargeVoltageContext(context.Background(), c, voltage)
+}
+
+func SetBatteryRechargeVoltageContext(ctx context.Context, c connector.Connector, voltage float32) error {
 	command := fmt.Sprintf("PBCV%.1f", voltage)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 // Valid values are
@@ -676,132 +866,209 @@ func SetBatteryRechargeVoltage(c connector.Connector, voltage float32) error {
 // 48V unit: 00.0/V48V/49V/50V/51V/52V/53V/54V/55V/56V/57V/58V
 // 00.0V means battery is full(charging in float mode).
 func SetBatteryRedischargeVoltage(c connector.Connector, voltage float32) error {
+	return SetBatteryRedischargeVoltageContext(context.Background(), c, voltage)
+}
+
+func SetBatteryRedischargeVoltageContext(ctx context.Context, c connector.Connector, voltage float32) error {
 	command := fmt.Sprintf("PBDV%.1f", voltage)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetChargerSourcePriority(c connector.Connector, priority ChargerSourcePriority) error {
+	return SetChargerSourcePriorityContext(context.Background(), c, priority)
+}
+
+func SetChargerSourcePriorityContext(ctx context.Context, c connector.Connector, priority ChargerSourcePriority) error {
 	command := fmt.Sprintf("PCP%02d", priority)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetGridWorkingRange(c connector.Connector, voltageRange VoltageRange) error {
+	return SetGridWorkingRangeContext(context.Background(), c, voltageRange)
+}
+
+func SetGridWorkingRangeContext(ctx context.Context, c connector.Connector, voltageRange VoltageRange) error {
 	command := fmt.Sprintf("PGR%02d", voltageRange)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetBatteryType(c connector.Connector, batteryType BatteryType) error {
+	return SetBatteryTypeContext(context.Background(), c, batteryType)
+}
+
+func SetBatteryTypeContext(ctx context.Context, c connector.Connector, batteryType BatteryType) error {
 	command := fmt.Sprintf("PBT%02d", batteryType)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetDeviceOutputMode(c connector.Connector, mode OutputMode) error {
+	return SetDeviceOutputModeContext(context.Background(), c, mode)
+}
+
+func SetDeviceOutputModeContext(ctx context.Context, c connector.Connector, mode OutputMode) error {
 	command := fmt.Sprintf("POPM%02d", mode)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetDeviceOutputVoltage(c connector.Connector, voltage uint8) error {
+	return SetDeviceOutputVoltageContext(context.Background(), c, voltage)
+}
+
+func SetDeviceOutputVoltageContext(ctx context.Context, c connector.Connector, voltage uint8) error {
 	command := fmt.Sprintf("POPV%03d", voltage)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetParallelChargerSourcePriority(c connector.Connector, priority ChargerSourcePriority, parallelNumber uint8) error {
+	return SetParallelChargerSourcePriorityContext(context.Background(), c, priority, parallelNumber)
+}
+
+func SetParallelChargerSourcePriorityContext(ctx context.Context, c connector.Connector, priority ChargerSourcePriority, parallelNumber uint8) error {
 	command := fmt.Sprintf("PPCP%1d%02d", parallelNumber, priority)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 // Valid range is 40.0V ~ 48.0V for 48V unit
 func SetBatteryCutoffVoltage(c connector.Connector, voltage float32) error {
+	return SetBatteryCutoffVoltageContext(context.Background(), c, voltage)
+}
+
+func SetBatteryCutoffVoltageContext(ctx context.Context, c connector.Connector, voltage float32) error {
 	command := fmt.Sprintf("PSDV%.1f", voltage)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 // Valid range is 48.0V ~ 58.4V for 48V unit
 func SetCVModeChargingVoltage(c connector.Connector, voltage float32) error {
+	return SetCVModeChargingVoltageContext(context.Background(), c, voltage)
+}
+
+func SetCVModeChargingVoltageContext(ctx context.Context, c connector.Connector, voltage float32) error {
 	command := fmt.Sprintf("PCVV%.1f", voltage)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 // Valid range is 48.0V ~ 58.4V for 48V unit
 func SetFloatChargingVoltage(c connector.Connector, voltage float32) error {
+	return SetFloatChargingVoltageContext(context.Background(), c, voltage)
+}
+
+func SetFloatChargingVoltageContext(ctx context.Context, c connector.Connector, voltage float32) error {
 	command := fmt.Sprintf("PBFT%.1f", voltage)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetDeviceChargingStage(c connector.Connector, mode OutputMode) error {
+	return SetDeviceChargingStageContext(context.Background(), c, mode)
+}
+
+func SetDeviceChargingStageContext(ctx context.Context, c connector.Connector, mode OutputMode) error {
 	command := fmt.Sprintf("PCST%02d", mode)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 // Valid times are
 // 0, 10, 20, 40, 60, 90, 120, 150, 180, 210, 240, 255, in minutes
 // 255 is a special value that makes the actual time automatically determined
 func SetCVModeChargingTime(c connector.Connector, chargingTime uint8) error {
+	return SetCVModeChargingTimeContext(context.Background(), c, chargingTime)
+}
+
+func SetCVModeChargingTimeContext(ctx context.Context, c connector.Connector, chargingTime uint8) error {
 	command := fmt.Sprintf("PCVT%03d", chargingTime)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetParallelPVOK(c connector.Connector, pvok ParallelPVOK) error {
+	return SetParallelPVOKContext(context.Background(), c, pvok)
+}
+
+func SetParallelPVOKContext(ctx context.Context, c connector.Connector, pvok ParallelPVOK) error {
 	command := fmt.Sprintf("PPVOKC%1d", pvok)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
 func SetPVPowerBalance(c connector.Connector, balance PVPowerBalance) error {
+	return SetPVPowerBalanceContext(context.Background(), c, balance)
+}
+
+func SetPVPowerBalanceContext(ctx context.Context, c connector.Connector, balance PVPowerBalance) error {
 	command := fmt.Sprintf("PSPB%1d", balance)
-	return sendCommand(c, command)
+	return sendCommand(ctx, c, command)
 }
 
-func sendCommand(c connector.Connector, command string) error {
-	resp, err := sendRequest(c, command)
+func sendCommand(ctx context.Context, c connector.Connector, command string) error {
+	resp, err := sendRequest(ctx, c, command)
 	if err != nil {
 		return err
 	}
 	if resp == "NAK" {
-		return fmt.Errorf("command not acknowledged, %v", command)
+		return fmt.Errorf("%w: %v", ErrNAK, command)
 	}
 	return nil
 }
 
-func sendRequest(c connector.Connector, req string) (resp string, err error) {
-	// defer timeTrack(time.Now(), "timing : "+req)
-	// log.Println("Sending request", req)
-	reqBytes := []byte(req)
-	reqBytes = append(reqBytes, crc(reqBytes)...)
-	reqBytes = append(reqBytes, cr)
-	// log.Println("Sending ", reqBytes)
-	err = c.Write(reqBytes)
+// Sends a query, returns ErrNotSupported if the inverter answers NAK.
+func sendQuery(ctx context.Context, c connector.Connector, query string) (resp string, err error) {
+	resp, err = sendRequest(ctx, c, query)
 	if err != nil {
 		return
 	}
+	if resp == "NAK" {
+		err = fmt.Errorf("%w: %v", ErrNotSupported, query)
+	}
+	return
+}
 
-	readBytes, err := c.ReadUntilCR()
+func sendRequest(ctx context.Context, c connector.Connector, req string) (resp string, err error) {
+	readBytes, err := transfer(ctx, c, req)
 	if err != nil {
 		return
 	}
 
-	// log.Println("Received ", readBytes)
 	err = validateResponse(readBytes)
 	if err != nil {
 		return
 	}
 
 	resp = string(readBytes[1 : len(readBytes)-3])
-	// log.Println("Received response: ", resp)
 	return
 }
 
+// Writes req with its CRC and reads the response up to CR.
+func transfer(ctx context.Context, c connector.Connector, req string) ([]byte, error) {
+	reqBytes := []byte(req)
+	reqBytes = append(reqBytes, crc(reqBytes)...)
+	reqBytes = append(reqBytes, cr)
+	logger.Load().Debug("sending request", "command", req)
+	err := connector.WriteContext(ctx, c, reqBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	readBytes, err := connector.ReadContext(ctx, c, cr)
+	if err != nil {
+		return nil, err
+	}
+	logger.Load().Debug("received response", "response", string(bytes.TrimSuffix(readBytes, []byte{cr})))
+	return readBytes, nil
+}
+
 func validateResponse(read []byte) error {
 	readLen := len(read)
+	if readLen < 4 {
+		return fmt.Errorf("%w: response of %d bytes", ErrFraming, readLen)
+	}
 	if read[0] != leftParen {
-		return fmt.Errorf("invalid response start %x", read[0])
+		return fmt.Errorf("%w: invalid response start %x", ErrFraming, read[0])
 	}
 	if read[readLen-1] != cr {
-		return fmt.Errorf("invalid response end %x", read[readLen-1])
+		return fmt.Errorf("%w: invalid response end %x", ErrFraming, read[readLen-1])
 	}
 	readCrc := read[readLen-3 : readLen-1]
 	calcCrc := crc(read[:readLen-3])
 	if !bytes.Equal(readCrc, calcCrc) {
-		return fmt.Errorf("CRC error, received %v, expected %v", readCrc, calcCrc)
+		return fmt.Errorf("%w, received %v, expected %v", ErrChecksum, readCrc, calcCrc)
 	}
 
 	return nil
@@ -838,7 +1105,7 @@ func parseFirmwareVersion(resp string, fwPrefix string) (*FirmwareVersion, error
 func parseRatingInfo(resp string) (*RatingInfo, error) {
 	parts := strings.Split(resp, " ")
 	if len(parts) < 25 {
-		return nil, fmt.Errorf("invalid response %s : not enough fields", resp)
+		return nil, fmt.Errorf("%w: %s", ErrShortResponse, resp)
 	}
 
 	info := RatingInfo{}
@@ -1000,7 +1267,7 @@ func parseDeviceFlags(resp string) (map[DeviceFlag]FlagStatus, error) {
 	flags := make(map[DeviceFlag]FlagStatus)
 
 	if len(resp) < 2 {
-		return nil, fmt.Errorf("response too short: %s", resp)
+		return nil, fmt.Errorf("%w: %s", ErrShortResponse, resp)
 	}
 	if strings.HasPrefix(resp, "E") {
 		value := FlagEnabled
@@ -1039,7 +1306,7 @@ func parseDeviceFlags(resp string) (map[DeviceFlag]FlagStatus, error) {
 func parseDeviceStatusParams(resp string) (*DeviceStatusParams, error) {
 	parts := strings.Split(resp, " ")
 	if len(parts) < 21 {
-		return nil, fmt.Errorf("response too short: %s", resp)
+		return nil, fmt.Errorf("%w: %s", ErrShortResponse, resp)
 	}
 
 	params := DeviceStatusParams{}
@@ -1181,7 +1448,7 @@ func parseDeviceStatusParams(resp string) (*DeviceStatusParams, error) {
 func parseDeviceStatusParams2(resp string, params *DeviceStatusParams) (*DeviceStatusParams, error) {
 	parts := strings.Split(resp, " ")
 	if len(parts) < 12 {
-		return params, fmt.Errorf("response too short: %s", resp)
+		return params, fmt.Errorf("%w: %s", ErrShortResponse, resp)
 	}
 
 	i, err := strconv.Atoi(parts[0])
@@ -1264,7 +1531,7 @@ func parseDeviceStatusParams2(resp string, params *DeviceStatusParams) (*DeviceS
 
 func parseWarnings(status string) ([]DeviceWarning, error) {
 	if len(status) < 32 {
-		return nil, fmt.Errorf("not enough status flags, %d", len(status))
+		return nil, fmt.Errorf("%w: %d status flags", ErrShortResponse, len(status))
 	}
 
 	if len(status) > 38 {
@@ -1287,7 +1554,7 @@ func parseWarnings(status string) ([]DeviceWarning, error) {
 func parseParallelInfo(resp string) (*ParallelInfo, error) {
 	parts := strings.Split(resp, " ")
 	if len(parts) < 27 {
-		return nil, fmt.Errorf("response too short: %s", resp)
+		return nil, fmt.Errorf("%w: %s", ErrShortResponse, resp)
 	}
 
 	info := ParallelInfo{}
@@ -1300,13 +1567,16 @@ func parseParallelInfo(resp string) (*ParallelInfo, error) {
 
 	info.SerialNumber = parts[1]
 
-	info.DeviceMode = parts[2]
+	info.DeviceMode, err = parseMode(parts[2])
+	if err != nil {
+		return nil, err
+	}
 
 	b, err = strconv.ParseUint(parts[3], 10, 8)
 	if err != nil {
 		return nil, err
 	}
-	info.FaultCode = uint8(b)
+	info.FaultCode = FaultCode(b)
 
 	f, err := strconv.ParseFloat(parts[4], 32)
 	if err != nil {
@@ -1449,7 +1719,7 @@ func parseParallelInfo(resp string) (*ParallelInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	info.PV1InputCurrent = i
+	info.PVChargingCurrent = i
 
 	i, err = strconv.Atoi(parts[26])
 	if err != nil {
@@ -1461,22 +1731,78 @@ func parseParallelInfo(resp string) (*ParallelInfo, error) {
 
 }
 
-// func parseParallelPVInfo(resp string, info *ParallelInfo) (*ParallelInfo, error) {
-// 	parts := strings.Split(resp, " ")
-// 	if len(parts) < 9 {
-// 		return info, fmt.Errorf("response too short: %s", resp)
-// 	}
+// Parses the QP2GS response into info: the PV1 current and power, the
+// voltage, current and power of PV2 and PV3, and the status bits of the
+// three chargers.
+func parseParallelPVInfo(resp string, info *ParallelInfo) (*ParallelInfo, error) {
+	parts := strings.Split(resp, " ")
+	if len(parts) < 9 {
+		return nil, fmt.Errorf("%w: %s", ErrShortResponse, resp)
+	}
+
+	i, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	info.PV1InputCurrent = i
+
+	i, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	info.PV1ChargingPower = i
 
-// 	i, err := strconv.Atoi(parts[1])
-// 	if err != nil {
-// 		return info, err
-// 	}
-// 	info.PV1ChargingPower = i
+	f, err := strconv.ParseFloat(parts[2], 32)
+	if err != nil {
+		return nil, err
+	}
+	info.PV2InputVoltage = float32(f)
 
-// 	// TODO: Someday, maybe, parse PV2 & PV3 values
+	i, err = strconv.Atoi(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	info.PV2InputCurrent = i
 
-// 	return info, nil
-// }
+	i, err = strconv.Atoi(parts[4])
+	if err != nil {
+		return nil, err
+	}
+	info.PV2ChargingPower = i
+
+	f, err = strconv.ParseFloat(parts[5], 32)
+	if err != nil {
+		return nil, err
+	}
+	info.PV3InputVoltage = float32(f)
+
+	i, err = strconv.Atoi(parts[6])
+	if err != nil {
+		return nil, err
+	}
+	info.PV3InputCurrent = i
+
+	i, err = strconv.Atoi(parts[7])
+	if err != nil {
+		return nil, err
+	}
+	info.PV3ChargingPower = i
+
+	b, err := strconv.ParseUint(parts[8], 2, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	sflags := uint8(b)
+	info.SCC1OK = sflags&0x80 == 0x80
+	info.SCC1Charging = sflags&0x40 == 0x40
+	info.SCC2OK = sflags&0x20 == 0x20
+	info.SCC2Charging = sflags&0x10 == 0x10
+	info.SCC3OK = sflags&0x08 == 0x08
+	info.SCC3Charging = sflags&0x04 == 0x04
+
+	return info, nil
+}
 
 // func timeTrack(start time.Time, name string) {
 // 	elapsed := time.Since(start)
@@ -402,3 +402,112 @@ func TestFormatDisabledFlags(t *testing.T) {
 	}
 
 }
+
+func TestParseParallelInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want ParallelInfo
+	}{
+		{
+			// QPGS0 reply of testdata/session-pi30.jsonl
+			name: "Battery mode",
+			resp: "1 92931701100510 B 00 000.0 00.00 230.0 50.00 0253 0194 005 51.4 001 100 000.0 001 0253 0194 004 10100010 1 2 060 120 030 00 000",
+			want: ParallelInfo{
+				DeviceExists:               true,
+				SerialNumber:               "92931701100510",
+				DeviceMode:                 ModeBattery,
+				FaultCode:                  FaultNone,
+				ACOutputVoltage:            230.0,
+				ACOutputFrequency:          50.0,
+				ACOutputApparentPower:      253,
+				ACOutputActivePower:        194,
+				OutputLoadPercent:          5,
+				BatteryVoltage:             51.4,
+				BatteryChargingCurrent:     1,
+				BatteryCapacity:            100,
+				TotalChargingCurrent:       1,
+				TotalACOutputApparentPower: 253,
+				TotalOutputActivePower:     194,
+				TotalACOutputPercent:       4,
+				SCC1OK:                     true,
+				SCC1Charging:               true,
+				LoadOn:                     true,
+				BatteryStatus:              BatteryNormal,
+				OutputMode:                 Parallel,
+				ChargerSourcePriority:      ChargerSolarAndUtility,
+				MaxChargerCurrent:          60,
+				MaxChargerRange:            120,
+				MaxACChargerCurrent:        30,
+			},
+		},
+		{
+			name: "Line mode",
+			resp: "1 92932004102443 L 00 229.8 49.98 229.9 49.99 0437 0398 008 53.6 025 087 312.4 050 0874 0796 008 11101011 1 1 080 120 030 12 003",
+			want: ParallelInfo{
+				DeviceExists:               true,
+				SerialNumber:               "92932004102443",
+				DeviceMode:                 ModeLine,
+				FaultCode:                  FaultNone,
+				GridVoltage:                229.8,
+				GridFrequency:              49.98,
+				ACOutputVoltage:            229.9,
+				ACOutputFrequency:          49.99,
+				ACOutputApparentPower:      437,
+				ACOutputActivePower:        398,
+				OutputLoadPercent:          8,
+				BatteryVoltage:             53.6,
+				BatteryChargingCurrent:     25,
+				BatteryCapacity:            87,
+				PV1InputVoltage:            312.4,
+				TotalChargingCurrent:       50,
+				TotalACOutputApparentPower: 874,
+				TotalOutputActivePower:     796,
+				TotalACOutputPercent:       8,
+				SCC1OK:                     true,
+				ACCharging:                 true,
+				SCC1Charging:               true,
+				BatteryStatus:              BatteryUnder,
+				LoadOn:                     true,
+				ConfigurationChanged:       true,
+				OutputMode:                 Parallel,
+				ChargerSourcePriority:      ChargerSolarFirst,
+				MaxChargerCurrent:          80,
+				MaxChargerRange:            120,
+				MaxACChargerCurrent:        30,
+				PVChargingCurrent:          12,
+				BatteryDischargeCurrent:    3,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseParallelInfo(tt.resp)
+			if err != nil {
+				t.Fatal("expected no error, got", err)
+			}
+			if *info != tt.want {
+				t.Errorf("expected %+v got %+v", tt.want, *info)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for i, c := range "PSLBFHD" {
+		mode, err := parseMode(string(c))
+		if err != nil {
+			t.Error("expected no error, got", err)
+		}
+		if mode != Mode(i) || mode.char() != byte(c) {
+			t.Error("expected ", Mode(i), " got ", mode)
+		}
+	}
+
+	for _, resp := range []string{"", "X", "BB"} {
+		_, err := parseMode(resp)
+		if err == nil {
+			t.Errorf("expected error for %q", resp)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package axpert
+
+import (
+	"testing"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+func TestDeviceGeneralStatusReplay(t *testing.T) {
+	c, err := connector.NewReplayConnector("testdata/session-pi30.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := DeviceGeneralStatus(c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if params.BatteryVoltage != 57.5 || params.PVChargingPower1 != 856 {
+		t.Error("unexpected status ", *params)
+	}
+
+	mode, err := DeviceMode(c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if mode != ModeBattery {
+		t.Error("expected battery mode, got ", mode)
+	}
+
+	info, err := ParallelDeviceInfo(c, 0)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	_, err = ParallelDeviceInfo2(c, 0, info)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if info.SerialNumber != "92931701100510" || info.ACOutputActivePower != 194 || info.PV1ChargingPower != 420 ||
+		info.PV2InputVoltage != 245.3 || info.PV2InputCurrent != 6 || !info.SCC2Charging || info.SCC3OK {
+		t.Error("unexpected parallel info ", *info)
+	}
+}
@@ -0,0 +1,431 @@
+package axpert
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// Responses of a 5kVA off-grid inverter the simulator starts out with
+const (
+	simProtocolId = "PI30"
+	simSerialNo   = "92931701100510"
+	simStatus     = "230.0 50.0 231.0 49.9 0300 0250 010 460 57.50 012 100 0069 0014 103.8 57.45 00000 00110110 00 07 00856 010"
+	simStatus2    = "0000 000.0 00.00 00000 00000000 0000 0000 0000 000.0 00.00 00000 00856"
+	simRating     = "230.0 21.7 230.0 50.0 21.7 5000 4000 48.0 48.0 47.5 53.2 51.9 2 30 120 0 0 1 9 01 0 0 51.0 0 1"
+	simParallel   = "1 92931701100510 B 00 000.0 00.00 230.0 50.00 0253 0194 005 51.4 001 100 000.0 001 0253 0194 004 10100010 1 2 060 120 030 00 000"
+	simParallelPV = "00 00000 000.0 00 00000 000.0 00 00000 11000000"
+)
+
+// Simulator is a virtual PI30 inverter. It answers queries from its internal
+// state, which the setter commands and the Set methods change.
+type Simulator struct {
+	mu             sync.Mutex
+	protocolId     string
+	serialNo       string
+	firmware       map[string]string
+	mode           Mode
+	rating         RatingInfo
+	flags          map[DeviceFlag]FlagStatus
+	status         DeviceStatusParams
+	warnings       []DeviceWarning
+	parallel       []ParallelInfo
+	chargingStage  ChargingStage
+	cvChargingTime uint8
+	unsupported    map[string]bool
+}
+
+func NewSimulator() *Simulator {
+	s := &Simulator{}
+	s.reset()
+	return s
+}
+
+// Restores the initial state, as the PF command does.
+func (s *Simulator) reset() {
+	s.protocolId = simProtocolId
+	s.serialNo = simSerialNo
+	s.firmware = map[string]string{
+		"QVFW":  "VERFW:00072.70",
+		"QVFW2": "VERFW2:00072.70",
+		"QVFW3": "VERFW3:00000.00",
+		"QVFW4": "VERFW4:00000.00",
+	}
+	s.mode = ModeBattery
+	s.rating = *mustParse(parseRatingInfo(simRating))
+	s.flags = mustParse(parseDeviceFlags("EakxyzDbjuv"))
+	s.status = *mustParse(parseDeviceStatusParams2(simStatus2, mustParse(parseDeviceStatusParams(simStatus))))
+	s.warnings = nil
+	s.parallel = []ParallelInfo{*mustParse(parseParallelPVInfo(simParallelPV, mustParse(parseParallelInfo(simParallel))))}
+	s.chargingStage = Auto
+	s.cvChargingTime = 255
+	if s.unsupported == nil {
+		s.unsupported = make(map[string]bool)
+	}
+}
+
+func mustParse[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Returns an in-memory connector to the simulator.
+func (s *Simulator) Connector() *connector.ResponderConnector {
+	return connector.NewResponderConnector(s)
+}
+
+func (s *Simulator) SetMode(mode Mode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = mode
+}
+
+func (s *Simulator) SetStatus(status DeviceStatusParams) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *Simulator) Status() DeviceStatusParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Simulator) SetRatingInfo(rating RatingInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rating = rating
+}
+
+func (s *Simulator) RatingInfo() RatingInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rating
+}
+
+func (s *Simulator) SetWarnings(warnings ...DeviceWarning) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warnings = warnings
+}
+
+// Sets the parallel info returned for QPGS0 to QPGSn and QP2GS0 to QP2GSn,
+// one per inverter.
+func (s *Simulator) SetParallelInfo(infos ...ParallelInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parallel = infos
+}
+
+// Makes the simulator answer the given queries, e.g. QPIGS2, with NAK like
+// models that do not implement them.
+func (s *Simulator) SetUnsupported(queries ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsupported = make(map[string]bool)
+	for _, q := range queries {
+		s.unsupported[q] = true
+	}
+}
+
+// Answers a single request frame, see connector.Responder. Requests with an
+// invalid CRC are answered with NAK.
+func (s *Simulator) Respond(request []byte) []byte {
+	reqLen := len(request)
+	if reqLen < 4 || request[reqLen-1] != cr || !bytes.Equal(request[reqLen-3:reqLen-1], crc(request[:reqLen-3])) {
+		return simFrame("NAK")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req := string(request[:reqLen-3])
+	if s.unsupported[req] {
+		return simFrame("NAK")
+	}
+	resp, ok := s.query(req)
+	if !ok {
+		resp = "ACK"
+		if !s.command(req) {
+			resp = "NAK"
+		}
+	}
+	return simFrame(resp)
+}
+
+func simFrame(resp string) []byte {
+	frame := append([]byte{leftParen}, resp...)
+	frame = append(frame, crc(frame)...)
+	return append(frame, cr)
+}
+
+func (s *Simulator) query(req string) (string, bool) {
+	switch req {
+	case "QPI":
+		return s.protocolId, true
+	case "QID":
+		return s.serialNo, true
+	case "QVFW", "QVFW2", "QVFW3", "QVFW4":
+		return s.firmware[req], true
+	case "QMOD":
+		return string(s.mode.char()), true
+	case "QPIRI":
+		return formatRatingInfo(&s.rating), true
+	case "QFLAG":
+		return formatFlagStatus(s.flags), true
+	case "QPIGS":
+		return formatDeviceStatusParams(&s.status), true
+	case "QPIGS2":
+		return formatDeviceStatusParams2(&s.status), true
+	case "QPIWS":
+		return formatWarnings(s.warnings), true
+	case "QOPM":
+		return fmt.Sprintf("%d", s.rating.OutputMode), true
+	case "QCST":
+		return fmt.Sprintf("%02d", s.chargingStage), true
+	case "QCVT":
+		return fmt.Sprintf("%03d", s.cvChargingTime), true
+	}
+
+	if index, ok := strings.CutPrefix(req, "QPGS"); ok {
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= len(s.parallel) {
+			return "NAK", true
+		}
+		return formatParallelInfo(&s.parallel[i]), true
+	}
+
+	if index, ok := strings.CutPrefix(req, "QP2GS"); ok {
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= len(s.parallel) {
+			return "NAK", true
+		}
+		return formatParallelPVInfo(&s.parallel[i]), true
+	}
+
+	return "", false
+}
+
+// Applies a setter command, returns false if it is unknown or its value is
+// out of range.
+func (s *Simulator) command(req string) bool {
+	if req == "PF" {
+		s.reset()
+		return true
+	}
+	if flags, ok := strings.CutPrefix(req, "PE"); ok {
+		return s.setFlags(flags, FlagEnabled)
+	}
+	if flags, ok := strings.CutPrefix(req, "PD"); ok {
+		return s.setFlags(flags, FlagDisabled)
+	}
+
+	// Longest prefixes first, e.g. POPM and POPV before POP
+	switch {
+	case strings.HasPrefix(req, "POPM"):
+		return setUint(req[4:], 4, func(v uint8) { s.rating.OutputMode = OutputMode(v) })
+	case strings.HasPrefix(req, "POPV"):
+		return setUint(req[4:], 255, func(v uint8) { s.rating.ACOutputRatingVoltage = float32(v) })
+	case strings.HasPrefix(req, "POP"):
+		return setUint(req[3:], 2, func(v uint8) { s.rating.OutputSourcePriority = OutputSourcePriority(v) })
+	case strings.HasPrefix(req, "MNCHGC"):
+		return setUint(req[6:], 255, func(v uint8) { s.rating.MaxChargingCurrent = int(v) })
+	case strings.HasPrefix(req, "MCHGC") && len(req) > 5:
+		return setUint(req[6:], 255, func(v uint8) { s.rating.MaxChargingCurrent = int(v) })
+	case strings.HasPrefix(req, "MUCHGC"):
+		return setUint(req[6:], 255, func(v uint8) { s.rating.MaxACChargingCurrent = int(v) })
+	case strings.HasPrefix(req, "MSCHGC"):
+		return setUint(req[6:], 255, func(v uint8) {})
+	case strings.HasPrefix(req, "PPCP") && len(req) > 4:
+		return setUint(req[5:], 3, func(v uint8) { s.rating.ChargerSourcePriority = ChargerSourcePriority(v) })
+	case strings.HasPrefix(req, "PCP"):
+		return setUint(req[3:], 3, func(v uint8) { s.rating.ChargerSourcePriority = ChargerSourcePriority(v) })
+	case strings.HasPrefix(req, "PGR"):
+		return setUint(req[3:], 1, func(v uint8) { s.rating.InputVoltageRange = VoltageRange(v) })
+	case strings.HasPrefix(req, "PBT"):
+		return setUint(req[3:], 2, func(v uint8) { s.rating.BatteryType = BatteryType(v) })
+	case strings.HasPrefix(req, "PCST"):
+		return setUint(req[4:], 2, func(v uint8) { s.chargingStage = ChargingStage(v) })
+	case strings.HasPrefix(req, "PCVT"):
+		return setUint(req[4:], 255, func(v uint8) { s.cvChargingTime = v })
+	case strings.HasPrefix(req, "PPVOKC"):
+		return setUint(req[6:], 1, func(v uint8) { s.rating.ParallelPVOK = ParallelPVOK(v) })
+	case strings.HasPrefix(req, "PSPB"):
+		return setUint(req[4:], 1, func(v uint8) { s.rating.PVPowerBalance = PVPowerBalance(v) })
+	case req == "F50" || req == "F60":
+		return setUint(req[1:], 60, func(v uint8) { s.rating.ACOutputRatingFrequency = float32(v) })
+	case strings.HasPrefix(req, "PBCV"):
+		return setFloat(req[4:], func(v float32) { s.rating.BatteryRechargeVoltage = v })
+	case strings.HasPrefix(req, "PBDV"):
+		return setFloat(req[4:], func(v float32) { s.rating.BatteryRedischargeVoltage = v })
+	case strings.HasPrefix(req, "PSDV"):
+		return setFloat(req[4:], func(v float32) { s.rating.BatteryUnderVoltage = v })
+	case strings.HasPrefix(req, "PCVV"):
+		return setFloat(req[4:], func(v float32) { s.rating.BatteryBulkVoltage = v })
+	case strings.HasPrefix(req, "PBFT"):
+		return setFloat(req[4:], func(v float32) { s.rating.BatteryFloatVoltage = v })
+	}
+
+	return false
+}
+
+func setUint(value string, max uint8, set func(uint8)) bool {
+	b, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || uint8(b) > max {
+		return false
+	}
+	set(uint8(b))
+	return true
+}
+
+func setFloat(value string, set func(float32)) bool {
+	f, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return false
+	}
+	set(float32(f))
+	return true
+}
+
+func (s *Simulator) setFlags(flags string, status FlagStatus) bool {
+	if flags == "" {
+		return false
+	}
+	for i := range flags {
+		flag, ok := parseFlagChar(flags[i])
+		if !ok {
+			return false
+		}
+		s.flags[flag] = status
+	}
+	return true
+}
+
+func parseFlagChar(c byte) (DeviceFlag, bool) {
+	for f := Buzzer; f <= DataLogPopUp; f++ {
+		if f.char() == c {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+func formatRatingInfo(r *RatingInfo) string {
+	return fmt.Sprintf("%05.1f %04.1f %05.1f %04.1f %04.1f %04d %04d %04.1f %04.1f %04.1f %04.1f %04.1f %d %02d %03d %d %d %d %d %02d %d %d %04.1f %d %d",
+		r.GridRatingVoltage, r.GridRatingCurrent, r.ACOutputRatingVoltage, r.ACOutputRatingFrequency, r.ACOutputRatingCurrent,
+		r.ACOutputRatingApparentPower, r.ACOutputRatingActivePower, r.BatteryRatingVoltage, r.BatteryRechargeVoltage,
+		r.BatteryUnderVoltage, r.BatteryBulkVoltage, r.BatteryFloatVoltage, r.BatteryType, r.MaxACChargingCurrent,
+		r.MaxChargingCurrent, r.InputVoltageRange, r.OutputSourcePriority, r.ChargerSourcePriority, r.ParallelMaxNumber,
+		r.MachineType, r.Topology, r.OutputMode, r.BatteryRedischargeVoltage, r.ParallelPVOK, r.PVPowerBalance)
+}
+
+func formatFlagStatus(flags map[DeviceFlag]FlagStatus) string {
+	enabled := new(strings.Builder)
+	disabled := new(strings.Builder)
+	for f := Buzzer; f <= DataLogPopUp; f++ {
+		status, ok := flags[f]
+		switch {
+		case !ok:
+			continue
+		case status == FlagEnabled:
+			enabled.WriteByte(f.char())
+		default:
+			disabled.WriteByte(f.char())
+		}
+	}
+	return "E" + enabled.String() + "D" + disabled.String()
+}
+
+func formatDeviceStatusParams(p *DeviceStatusParams) string {
+	var sflags uint8
+	for i, set := range []bool{p.ACChargingOn, p.SCC1ChargingOn, p.ChargingOn, p.BatteryVoltageSteadyWhileCharging,
+		p.LoadOn, p.SCCFirmwareVersionUpdated, p.ConfigStatusChanged, p.AddSBUPriorityVersion} {
+		if set {
+			sflags |= 1 << i
+		}
+	}
+
+	return fmt.Sprintf("%05.1f %04.1f %05.1f %04.1f %04d %04d %03d %03d %05.2f %03d %03d %04d %04d %05.1f %05.2f %05d %08b %02d %s %05d %s%s0",
+		p.GridVoltage, p.GridFrequency, p.ACOutputVoltage, p.ACOutputFrequency, p.ACOutputApparentPower,
+		p.ACOutputActivePower, p.OutputLoadPercent, p.BusVoltage, p.BatteryVoltage, p.BatteryChargingCurrent,
+		p.BatteryCapacity, p.HeatSinkTemperature, p.PVInputCurrent1, p.PVInputVoltage1, p.BatteryVoltageSCC1,
+		p.BatteryDischargeCurrent, sflags, p.FanBatteryVoltageOffset, p.EEPROMVersion, p.PVChargingPower1,
+		bit(p.FloatingModeCharging), bit(p.SwitchOn))
+}
+
+func formatDeviceStatusParams2(p *DeviceStatusParams) string {
+	var sflags uint8
+	if p.SCC2ChargingOn {
+		sflags |= 0x80
+	}
+	if p.SCC3ChargingOn {
+		sflags |= 0x40
+	}
+
+	return fmt.Sprintf("%04d %05.1f %05.2f %05d %08b %04d %04d %04d %05.1f %05.2f %05d %05d",
+		p.PVInputCurrent2, p.PVInputVoltage2, p.BatteryVoltageSCC2, p.PVChargingPower2, sflags,
+		p.ACChargingCurrent, p.ACChargingPower, p.PVInputCurrent3, p.PVInputVoltage3, p.BatteryVoltageSCC3,
+		p.PVChargingPower3, p.PVTotalChargingPower)
+}
+
+func formatWarnings(warnings []DeviceWarning) string {
+	status := []byte(strings.Repeat("0", 36))
+	for _, w := range warnings {
+		for int(w) >= len(status) {
+			status = append(status, '0')
+		}
+		status[w] = '1'
+	}
+	return string(status)
+}
+
+func formatParallelInfo(info *ParallelInfo) string {
+	var sflags uint8
+	for i, set := range []bool{info.ConfigurationChanged, info.LoadOn, info.LineLoss} {
+		if set {
+			sflags |= 1 << i
+		}
+	}
+	sflags |= uint8(info.BatteryStatus&0x03) << 3
+	for i, set := range []bool{info.SCC1Charging, info.ACCharging, info.SCC1OK} {
+		if set {
+			sflags |= 0x20 << i
+		}
+	}
+
+	return fmt.Sprintf("%s %s %c %02d %05.1f %05.2f %05.1f %05.2f %04d %04d %03d %04.1f %03d %03d %05.1f %03d %04d %04d %03d %08b %d %d %03d %03d %03d %02d %03d",
+		bit(info.DeviceExists), info.SerialNumber, info.DeviceMode.char(), info.FaultCode, info.GridVoltage,
+		info.GridFrequency, info.ACOutputVoltage, info.ACOutputFrequency, info.ACOutputApparentPower,
+		info.ACOutputActivePower, info.OutputLoadPercent, info.BatteryVoltage, info.BatteryChargingCurrent,
+		info.BatteryCapacity, info.PV1InputVoltage, info.TotalChargingCurrent, info.TotalACOutputApparentPower,
+		info.TotalOutputActivePower, info.TotalACOutputPercent, sflags, info.OutputMode,
+		info.ChargerSourcePriority, info.MaxChargerCurrent, info.MaxChargerRange, info.MaxACChargerCurrent,
+		info.PVChargingCurrent, info.BatteryDischargeCurrent)
+}
+
+func formatParallelPVInfo(info *ParallelInfo) string {
+	var sflags uint8
+	for i, set := range []bool{info.SCC3Charging, info.SCC3OK, info.SCC2Charging, info.SCC2OK, info.SCC1Charging, info.SCC1OK} {
+		if set {
+			sflags |= 0x04 << i
+		}
+	}
+
+	return fmt.Sprintf("%02d %05d %05.1f %02d %05d %05.1f %02d %05d %08b",
+		info.PV1InputCurrent, info.PV1ChargingPower, info.PV2InputVoltage, info.PV2InputCurrent,
+		info.PV2ChargingPower, info.PV3InputVoltage, info.PV3InputCurrent, info.PV3ChargingPower, sflags)
+}
+
+func bit(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,136 @@
+package axpert
+
+import (
+	"testing"
+)
+
+func TestSimulatorFormatsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		resp   string
+		format func(string) string
+	}{
+		{name: "QPIRI", resp: simRating, format: func(resp string) string {
+			return formatRatingInfo(mustParse(parseRatingInfo(resp)))
+		}},
+		{name: "QPIGS", resp: simStatus, format: func(resp string) string {
+			return formatDeviceStatusParams(mustParse(parseDeviceStatusParams(resp)))
+		}},
+		{name: "QPIGS2", resp: "0012 105.2 52.50 00840 11000000 0021 0900 0015 100.2 48.48 00790 01890", format: func(resp string) string {
+			return formatDeviceStatusParams2(mustParse(parseDeviceStatusParams2(resp, &DeviceStatusParams{})))
+		}},
+		{name: "QPGS", resp: simParallel, format: func(resp string) string {
+			return formatParallelInfo(mustParse(parseParallelInfo(resp)))
+		}},
+		{name: "QP2GS", resp: "08 00420 245.3 06 00310 000.0 00 00000 11110000", format: func(resp string) string {
+			return formatParallelPVInfo(mustParse(parseParallelPVInfo(resp, &ParallelInfo{})))
+		}},
+		{name: "QFLAG", resp: "EakxyzDbjuv", format: func(resp string) string {
+			return formatFlagStatus(mustParse(parseDeviceFlags(resp)))
+		}},
+		{name: "QPIWS", resp: "010000000000000000000000000000000100", format: func(resp string) string {
+			return formatWarnings(mustParse(parseWarnings(resp)))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format(tt.resp); got != tt.resp {
+				t.Errorf("got  %q\nwant %q", got, tt.resp)
+			}
+		})
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	sim := NewSimulator()
+	c := sim.Connector()
+
+	id, err := ProtocolId(c)
+	if err != nil || id != "PI30" {
+		t.Errorf("ProtocolId() got = %v, %v", id, err)
+	}
+
+	params, err := DeviceGeneralStatus(c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	params, err = DeviceGeneralStatus2(c, params)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if params.BatteryVoltage != 57.5 || params.PVTotalChargingPower != 856 {
+		t.Error("unexpected status ", *params)
+	}
+	params, err = DeviceGeneralStatus2(c, nil)
+	if err != nil || params.BatteryVoltage != 0 || params.PVTotalChargingPower != 856 {
+		t.Errorf("DeviceGeneralStatus2(nil) got = %+v, %v", params, err)
+	}
+
+	err = SetOutputSourcePriority(c, OutputSBUFirst)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	err = SetBatteryRechargeVoltage(c, 46)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	rating, err := DeviceRatingInfo(c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if rating.OutputSourcePriority != OutputSBUFirst || rating.BatteryRechargeVoltage != 46 {
+		t.Error("setters not applied ", *rating)
+	}
+
+	err = DisableDeviceFlags(c, []DeviceFlag{Buzzer})
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	flags, err := DeviceFlagStatus(c)
+	if err != nil || flags[Buzzer] != FlagDisabled {
+		t.Errorf("DeviceFlagStatus() got = %v, %v, want buzzer disabled", flags, err)
+	}
+
+	err = SetOutputSourcePriority(c, OutputSourcePriority(7))
+	if err == nil {
+		t.Error("expected NAK for out of range priority")
+	}
+
+	sim.SetWarnings(WarnFanLocked, WarnBatteryOpen)
+	warnings, err := WarningStatus(c)
+	if err != nil || len(warnings) != 2 || warnings[0] != WarnFanLocked || warnings[1] != WarnBatteryOpen {
+		t.Errorf("WarningStatus() got = %v, %v", warnings, err)
+	}
+
+	_, err = ParallelDeviceInfo(c, 1)
+	if err == nil {
+		t.Error("expected error for missing parallel inverter")
+	}
+
+	sim.SetParallelInfo(ParallelInfo{DeviceExists: true, PVChargingCurrent: 9, PV1InputCurrent: 8, PV2ChargingPower: 310, SCC2OK: true})
+	info, err := ParallelDeviceInfo(c, 0)
+	if err == nil {
+		_, err = ParallelDeviceInfo2(c, 0, info)
+	}
+	if err != nil || info.PVChargingCurrent != 9 || info.PV1InputCurrent != 8 || info.PV2ChargingPower != 310 || !info.SCC2OK {
+		t.Errorf("ParallelDeviceInfo2() got = %+v, %v", info, err)
+	}
+	info, err = ParallelDeviceInfo2(c, 0, nil)
+	if err != nil || info.PVChargingCurrent != 0 || info.PV2ChargingPower != 310 {
+		t.Errorf("ParallelDeviceInfo2(nil) got = %+v, %v", info, err)
+	}
+
+	sim.SetUnsupported("QPIGS2")
+	resp, err := sendRequest(t.Context(), c, "QPIGS2")
+	if err != nil || resp != "NAK" {
+		t.Errorf("QPIGS2 got = %v, %v, want NAK", resp, err)
+	}
+
+	err = SetDefaultSettings(c)
+	if err != nil {
+		t.Fatal("expected no error, got", err)
+	}
+	if sim.RatingInfo().OutputSourcePriority != OutputUtilityFirst {
+		t.Error("PF did not restore defaults")
+	}
+}
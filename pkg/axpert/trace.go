@@ -0,0 +1,33 @@
+package axpert
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Describes the framing of a request or response for tracing, see
+// connector.FrameDecoder.
+func DescribeFrame(data []byte) string {
+	dataLen := len(data)
+	if dataLen < 4 || data[dataLen-1] != cr {
+		return "incomplete frame"
+	}
+
+	payload := data[:dataLen-3]
+	readCrc := data[dataLen-3 : dataLen-1]
+	calcCrc := crc(payload)
+	crcStatus := "ok"
+	if !bytes.Equal(readCrc, calcCrc) {
+		crcStatus = fmt.Sprintf("mismatch, expected %X", calcCrc)
+	}
+
+	if payload[0] == leftParen {
+		return fmt.Sprintf("response %q crc=%X %s", payload[1:], readCrc, crcStatus)
+	}
+	// PI18 responses, ^D with data or ^0/^1 for NAK/ACK
+	if len(payload) >= 2 && payload[0] == caret && strings.ContainsRune("D01", rune(payload[1])) {
+		return fmt.Sprintf("response %q crc=%X %s", payload, readCrc, crcStatus)
+	}
+	return fmt.Sprintf("request %q crc=%X %s", payload, readCrc, crcStatus)
+}
@@ -0,0 +1,138 @@
+package axpert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// Protocol is the command set an inverter speaks, as reported by QPI. The
+// results are the same for all protocols, values a protocol does not report
+// are left zero.
+type Protocol interface {
+	Name() string
+	DeviceGeneralStatus(ctx context.Context, c connector.Connector) (*DeviceStatusParams, error)
+	DeviceRatingInfo(ctx context.Context, c connector.Connector) (*RatingInfo, error)
+	DeviceFlagStatus(ctx context.Context, c connector.Connector) (map[DeviceFlag]FlagStatus, error)
+	WarningStatus(ctx context.Context, c connector.Connector) ([]DeviceWarning, error)
+	DeviceMode(ctx context.Context, c connector.Connector) (Mode, error)
+	ParallelDeviceInfo(ctx context.Context, c connector.Connector, inverterIndex int) (*ParallelInfo, error)
+	EnableDeviceFlags(ctx context.Context, c connector.Connector, flags []DeviceFlag) error
+	DisableDeviceFlags(ctx context.Context, c connector.Connector, flags []DeviceFlag) error
+	SetOutputSourcePriority(ctx context.Context, c connector.Connector, priority OutputSourcePriority) error
+	SetChargerSourcePriority(ctx context.Context, c connector.Connector, priority ChargerSourcePriority) error
+	SetMaxTotalChargingCurrent(ctx context.Context, c connector.Connector, current uint8, parallelNumber uint8) error
+	SetMaxUtilityChargingCurrent(ctx context.Context, c connector.Connector, current uint8) error
+	SetBatteryCutoffVoltage(ctx context.Context, c connector.Connector, voltage float32) error
+	SetBatteryType(ctx context.Context, c connector.Connector, batteryType BatteryType) error
+}
+
+var (
+	// Axpert/Voltronic PI30 protocol, the package level functions
+	PI30 Protocol = pi30{}
+	// InfiniSolar PI18 protocol with ^P/^S framed commands
+	PI18 Protocol = pi18{}
+)
+
+// Time to wait for the QPI response in DetectProtocol, PI18 units never
+// answer it
+const protocolProbeTimeout = 2 * time.Second
+
+// Detects the protocol of the inverter with QPI. PI18 units do not answer
+// QPI, when it fails the PI18 equivalent ^P005PI is tried.
+func DetectProtocol(c connector.Connector) (Protocol, error) {
+	return DetectProtocolContext(context.Background(), c)
+}
+
+func DetectProtocolContext(ctx context.Context, c connector.Connector) (Protocol, error) {
+	pctx, cancel := context.WithTimeout(ctx, protocolProbeTimeout)
+	id, err := ProtocolIdContext(pctx, c)
+	cancel()
+	if err == nil {
+		return protocolById(id)
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	version, err18 := pi18Query(ctx, c, "PI")
+	if err18 != nil {
+		return nil, errors.Join(err, err18)
+	}
+	return protocolById("PI" + version)
+}
+
+func protocolById(id string) (Protocol, error) {
+	switch id {
+	case "PI30":
+		return PI30, nil
+	case "PI18":
+		return PI18, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownProtocol, id)
+}
+
+type pi30 struct{}
+
+func (pi30) Name() string {
+	return "PI30"
+}
+
+func (pi30) DeviceGeneralStatus(ctx context.Context, c connector.Connector) (*DeviceStatusParams, error) {
+	return DeviceGeneralStatusContext(ctx, c)
+}
+
+func (pi30) DeviceRatingInfo(ctx context.Context, c connector.Connector) (*RatingInfo, error) {
+	return DeviceRatingInfoContext(ctx, c)
+}
+
+func (pi30) DeviceFlagStatus(ctx context.Context, c connector.Connector) (map[DeviceFlag]FlagStatus, error) {
+	return DeviceFlagStatusContext(ctx, c)
+}
+
+func (pi30) WarningStatus(ctx context.Context, c connector.Connector) ([]DeviceWarning, error) {
+	return WarningStatusContext(ctx, c)
+}
+
+func (pi30) DeviceMode(ctx context.Context, c connector.Connector) (Mode, error) {
+	return DeviceModeContext(ctx, c)
+}
+
+func (pi30) ParallelDeviceInfo(ctx context.Context, c connector.Connector, inverterIndex int) (*ParallelInfo, error) {
+	return ParallelDeviceInfoContext(ctx, c, inverterIndex)
+}
+
+func (pi30) EnableDeviceFlags(ctx context.Context, c connector.Connector, flags []DeviceFlag) error {
+	return EnableDeviceFlagsContext(ctx, c, flags)
+}
+
+func (pi30) DisableDeviceFlags(ctx context.Context, c connector.Connector, flags []DeviceFlag) error {
+	return DisableDeviceFlagsContext(ctx, c, flags)
+}
+
+func (pi30) SetOutputSourcePriority(ctx context.Context, c connector.Connector, priority OutputSourcePriority) error {
+	return SetOutputSourcePriorityContext(ctx, c, priority)
+}
+
+func (pi30) SetChargerSourcePriority(ctx context.Context, c connector.Connector, priority ChargerSourcePriority) error {
+	return SetChargerSourcePriorityContext(ctx, c, priority)
+}
+
+func (pi30) SetMaxTotalChargingCurrent(ctx context.Context, c connector.Connector, current uint8, parallelNumber uint8) error {
+	return SetMaxTotalChargingCurrentContext(ctx, c, current, parallelNumber)
+}
+
+func (pi30) SetMaxUtilityChargingCurrent(ctx context.Context, c connector.Connector, current uint8) error {
+	return SetMaxUtilityChargingCurrentContext(ctx, c, current)
+}
+
+func (pi30) SetBatteryCutoffVoltage(ctx context.Context, c connector.Connector, voltage float32) error {
+	return SetBatteryCutoffVoltageContext(ctx, c, voltage)
+}
+
+func (pi30) SetBatteryType(ctx context.Context, c connector.Connector, batteryType BatteryType) error {
+	return SetBatteryTypeContext(ctx, c, batteryType)
+}
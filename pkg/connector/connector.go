@@ -1,5 +1,7 @@
 package connector
 
+import "context"
+
 type Connector interface {
 	Open() error
 	Close()
@@ -7,3 +9,56 @@ type Connector interface {
 	Read(terminator byte) ([]byte, error)
 	Write(bytes []byte) error
 }
+
+// ContextConnector is implemented by connectors whose reads and writes can
+// be cancelled or bounded by a context.
+type ContextConnector interface {
+	Connector
+	ReadContext(ctx context.Context, terminator byte) ([]byte, error)
+	WriteContext(ctx context.Context, bytes []byte) error
+}
+
+// Reads from c until terminator, giving up when ctx is done. Connectors that
+// do not implement ContextConnector are read in a separate goroutine, which
+// is left behind when ctx is done before the read returns.
+func ReadContext(ctx context.Context, c Connector, terminator byte) ([]byte, error) {
+	if cc, ok := c.(ContextConnector); ok {
+		return cc.ReadContext(ctx, terminator)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return c.Read(terminator)
+	}
+
+	type readResult struct {
+		data []byte
+		err  error
+	}
+	resultCh := make(chan readResult, 1)
+	go func() {
+		data, err := c.Read(terminator)
+		resultCh <- readResult{data: data, err: err}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.data, result.err
+	case <-ctx.Done():
+		return nil, timeoutError(ctx.Err())
+	}
+}
+
+// Writes bytes to c, giving up when ctx is done. Connectors that do not
+// implement ContextConnector are only checked for cancellation before the
+// write.
+func WriteContext(ctx context.Context, c Connector, bytes []byte) error {
+	if cc, ok := c.(ContextConnector); ok {
+		return cc.WriteContext(ctx, bytes)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Write(bytes)
+}
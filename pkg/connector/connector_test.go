@@ -0,0 +1,33 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadContextFallback(t *testing.T) {
+	// A connector without context support whose read never completes
+	blocked := make(chan struct{})
+	defer close(blocked)
+	c := &blockingConnector{blocked: blocked}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := ReadContext(ctx, c, '\r')
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+type blockingConnector struct {
+	scriptedConnector
+	blocked chan struct{}
+}
+
+func (bc *blockingConnector) Read(terminator byte) ([]byte, error) {
+	<-bc.blocked
+	return nil, errors.New("closed")
+}
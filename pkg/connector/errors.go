@@ -0,0 +1,35 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+var (
+	// A read or write did not complete within the configured timeout or the
+	// context deadline. The underlying error stays in the chain.
+	ErrTimeout = errors.New("timeout")
+	// The connector was not opened, or has been closed
+	ErrNotOpen = errors.New("not open")
+	// A ReconnectConnector lost its device and has not reconnected yet
+	ErrDisconnected = errors.New("device disconnected")
+)
+
+// Marks err as ErrTimeout if it was caused by a deadline.
+func timeoutError(err error) error {
+	if err == nil || errors.Is(err, ErrTimeout) || !isTimeout(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrTimeout, err)
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package connector
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTY is a pseudo-terminal pair, the master end is read and written by a
+// simulator while clients open the slave at Path like a serial port.
+type PTY struct {
+	Master *os.File
+	Path   string
+	// Kept open so reads on the master do not fail while no client is
+	// connected
+	slave *os.File
+}
+
+func OpenPTY() (*PTY, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fd := int(master.Fd())
+	err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to get pty number: %w", err)
+	}
+	path := fmt.Sprintf("/dev/pts/%d", n)
+
+	slave, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	// Raw mode, so requests and responses are neither echoed nor translated
+	termios, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS)
+	if err == nil {
+		termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		termios.Oflag &^= unix.OPOST
+		termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		termios.Cflag &^= unix.CSIZE | unix.PARENB
+		termios.Cflag |= unix.CS8
+		err = unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, termios)
+	}
+	if err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("failed to set pty raw mode: %w", err)
+	}
+
+	return &PTY{Master: master, Path: path, slave: slave}, nil
+}
+
+func (p *PTY) Read(b []byte) (int, error) {
+	return p.Master.Read(b)
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.Master.Write(b)
+}
+
+func (p *PTY) Close() error {
+	p.slave.Close()
+	return p.Master.Close()
+}
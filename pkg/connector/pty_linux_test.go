@@ -0,0 +1,56 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+)
+
+func TestPTY(t *testing.T) {
+	pty, err := OpenPTY()
+	if err != nil {
+		t.Skip("no pseudo-terminal available: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Serve(ctx, pty, 0x0d, reverseResponder{})
+
+	sc := NewSerialConnector(serial.Config{Address: pty.Path, BaudRate: 2400, Timeout: time.Second})
+	err = sc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	sc.Write([]byte("QPI\r"))
+	got, err := sc.ReadUntilCR()
+	if err != nil || string(got) != "IPQ\r" {
+		t.Errorf("ReadUntilCR() got = %q, %v", got, err)
+	}
+}
+
+func TestSerialConnectorTimeout(t *testing.T) {
+	pty, err := OpenPTY()
+	if err != nil {
+		t.Skip("no pseudo-terminal available: ", err)
+	}
+	defer pty.Close()
+
+	sc := NewSerialConnector(serial.Config{Address: pty.Path, BaudRate: 2400, Timeout: 200 * time.Millisecond})
+	err = sc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	// The configured timeout applies to a ctx without deadline as well
+	start := time.Now()
+	_, err = sc.ReadContext(context.Background(), 0x0d)
+	if !errors.Is(err, ErrTimeout) || time.Since(start) > 2*time.Second {
+		t.Errorf("ReadContext() error = %v after %v, want %v", err, time.Since(start), ErrTimeout)
+	}
+}
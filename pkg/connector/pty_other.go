@@ -0,0 +1,29 @@
+//go:build !linux
+
+package connector
+
+import (
+	"errors"
+	"os"
+)
+
+type PTY struct {
+	Master *os.File
+	Path   string
+}
+
+func OpenPTY() (*PTY, error) {
+	return nil, errors.New("pseudo-terminals are only supported on linux")
+}
+
+func (p *PTY) Read(b []byte) (int, error) {
+	return p.Master.Read(b)
+}
+
+func (p *PTY) Write(b []byte) (int, error) {
+	return p.Master.Write(b)
+}
+
+func (p *PTY) Close() error {
+	return p.Master.Close()
+}
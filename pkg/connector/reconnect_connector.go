@@ -0,0 +1,242 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type State uint8
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "Disconnected"
+	case StateConnecting:
+		return "Connecting"
+	case StateConnected:
+		return "Connected"
+	}
+	return fmt.Sprintf("State(%d)", s)
+}
+
+type ReconnectConfig struct {
+	// Delay before the first reconnect attempt after a failed one, doubled
+	// on every further failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Number of consecutive read timeouts after which the device is assumed
+	// to be gone, 0 to never reconnect on timeouts.
+	MaxTimeouts int
+	// Whether reads ended by an expired context deadline count toward
+	// MaxTimeouts. Off by default, as a quiet line, e.g. while sniffing,
+	// would otherwise be reopened.
+	CountDeadlines bool
+}
+
+// ReconnectConnector wraps a connector that can be closed and opened again,
+// and reopens it when a read or write fails with an I/O error. Reconnect
+// attempts are made on the next Write, so a missing device fails fast rather
+// than blocking the caller, and are spaced with exponential backoff.
+//
+// It is safe for concurrent use, e.g. by a poller writing requests and a
+// sniffer reading the same line.
+type ReconnectConnector struct {
+	conn   Connector
+	config ReconnectConfig
+
+	// Guards the fields below, not held during reads and writes
+	connMu   sync.Mutex
+	open     bool
+	delay    time.Duration
+	retryAt  time.Time
+	timeouts int
+
+	mu            sync.Mutex
+	state         State
+	lastErr       error
+	onStateChange func(State, error)
+}
+
+func NewReconnectConnector(conn Connector, config ReconnectConfig) *ReconnectConnector {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+
+	return &ReconnectConnector{conn: conn, config: config, delay: config.MinBackoff}
+}
+
+func (rc *ReconnectConnector) Connector() Connector {
+	return rc.conn
+}
+
+// Returns the current connection state and the error that caused the last
+// disconnect, if any.
+func (rc *ReconnectConnector) State() (State, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state, rc.lastErr
+}
+
+// Sets a function called on every state change. It is called from the
+// goroutine using the connector and must not block.
+func (rc *ReconnectConnector) OnStateChange(f func(State, error)) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.onStateChange = f
+}
+
+// Opens the underlying connector, regardless of any backoff in progress.
+func (rc *ReconnectConnector) Open() error {
+	rc.connMu.Lock()
+	defer rc.connMu.Unlock()
+	return rc.connect()
+}
+
+func (rc *ReconnectConnector) Close() {
+	rc.connMu.Lock()
+	defer rc.connMu.Unlock()
+	if rc.open {
+		rc.conn.Close()
+		rc.open = false
+	}
+	rc.setState(StateDisconnected, nil)
+}
+
+func (rc *ReconnectConnector) ReadUntilCR() ([]byte, error) {
+	return rc.Read(0x0d)
+}
+
+func (rc *ReconnectConnector) Read(terminator byte) ([]byte, error) {
+	return rc.ReadContext(context.Background(), terminator)
+}
+
+func (rc *ReconnectConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	rc.connMu.Lock()
+	open := rc.open
+	rc.connMu.Unlock()
+	if !open {
+		return nil, rc.disconnectedError()
+	}
+
+	bytesRead, err := ReadContext(ctx, rc.conn, terminator)
+
+	rc.connMu.Lock()
+	defer rc.connMu.Unlock()
+	if err != nil {
+		rc.fail(ctx, err)
+		return nil, err
+	}
+
+	rc.timeouts = 0
+	return bytesRead, nil
+}
+
+func (rc *ReconnectConnector) Write(bytes []byte) error {
+	return rc.WriteContext(context.Background(), bytes)
+}
+
+func (rc *ReconnectConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	rc.connMu.Lock()
+	if !rc.open {
+		if time.Now().Before(rc.retryAt) {
+			rc.connMu.Unlock()
+			return rc.disconnectedError()
+		}
+		err := rc.connect()
+		if err != nil {
+			rc.connMu.Unlock()
+			return err
+		}
+	}
+	rc.connMu.Unlock()
+
+	err := WriteContext(ctx, rc.conn, bytes)
+	if err != nil {
+		rc.connMu.Lock()
+		defer rc.connMu.Unlock()
+		rc.fail(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// Must be called holding connMu.
+func (rc *ReconnectConnector) connect() error {
+	if rc.open {
+		return nil
+	}
+
+	rc.setState(StateConnecting, nil)
+	err := rc.conn.Open()
+	if err != nil {
+		rc.retryAt = time.Now().Add(rc.delay)
+		rc.delay = min(rc.delay*2, rc.config.MaxBackoff)
+		rc.setState(StateDisconnected, err)
+		return err
+	}
+
+	rc.open = true
+	rc.delay = rc.config.MinBackoff
+	rc.timeouts = 0
+	rc.setState(StateConnected, nil)
+	return nil
+}
+
+// Closes the underlying connector after an I/O error, the first reconnect is
+// attempted on the next write. Cancellations by the caller and timeouts, up
+// to MaxTimeouts in a row, leave the connection open. An expired ctx deadline
+// counts as a timeout with CountDeadlines. Must be called holding connMu.
+func (rc *ReconnectConnector) fail(ctx context.Context, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if !rc.config.CountDeadlines && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return
+	}
+	if isTimeout(err) {
+		rc.timeouts++
+		if rc.config.MaxTimeouts == 0 || rc.timeouts < rc.config.MaxTimeouts {
+			return
+		}
+	}
+
+	rc.conn.Close()
+	rc.open = false
+	rc.retryAt = time.Now()
+	rc.setState(StateDisconnected, err)
+}
+
+func (rc *ReconnectConnector) disconnectedError() error {
+	_, lastErr := rc.State()
+	if lastErr == nil {
+		return ErrDisconnected
+	}
+	return fmt.Errorf("%w: %w", ErrDisconnected, lastErr)
+}
+
+func (rc *ReconnectConnector) setState(state State, err error) {
+	rc.mu.Lock()
+	changed := rc.state != state
+	rc.state = state
+	if err != nil || state == StateConnected {
+		rc.lastErr = err
+	}
+	f := rc.onStateChange
+	rc.mu.Unlock()
+
+	if changed && f != nil {
+		f(state, err)
+	}
+}
@@ -0,0 +1,190 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fails opens while openErr is set and reads while readErr is set.
+type flakyConnector struct {
+	opens   int
+	isOpen  bool
+	openErr error
+	readErr error
+}
+
+func (fc *flakyConnector) Open() error {
+	fc.opens++
+	if fc.openErr != nil {
+		return fc.openErr
+	}
+	fc.isOpen = true
+	return nil
+}
+
+func (fc *flakyConnector) Close() {
+	fc.isOpen = false
+}
+
+func (fc *flakyConnector) ReadUntilCR() ([]byte, error) {
+	return fc.Read(0x0d)
+}
+
+func (fc *flakyConnector) Read(terminator byte) ([]byte, error) {
+	if fc.readErr != nil {
+		return nil, fc.readErr
+	}
+	return []byte("(ACK\r"), nil
+}
+
+func (fc *flakyConnector) Write(bytes []byte) error {
+	if !fc.isOpen {
+		return errors.New("not open")
+	}
+	return nil
+}
+
+func TestReconnectConnector(t *testing.T) {
+	fc := &flakyConnector{}
+	rc := NewReconnectConnector(fc, ReconnectConfig{MinBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond})
+
+	var states []State
+	rc.OnStateChange(func(s State, err error) {
+		states = append(states, s)
+	})
+
+	err := rc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Device unplugged
+	fc.readErr = errors.New("failed to read from HID device")
+	fc.openErr = errors.New("no such device")
+	rc.Write([]byte("QPI\r"))
+	_, err = rc.ReadUntilCR()
+	if err == nil {
+		t.Fatal("expected read error, got nil")
+	}
+	if state, lastErr := rc.State(); state != StateDisconnected || lastErr == nil {
+		t.Errorf("State() got = %v, %v, want Disconnected with error", state, lastErr)
+	}
+
+	// The first reconnect attempt is immediate and fails
+	err = rc.Write([]byte("QPI\r"))
+	if err == nil || fc.opens != 2 {
+		t.Fatalf("Write() error = %v after %d opens, want failed reopen", err, fc.opens)
+	}
+
+	// Further writes fail fast until the backoff has passed
+	err = rc.Write([]byte("QPI\r"))
+	if err == nil || fc.opens != 2 {
+		t.Fatalf("Write() error = %v after %d opens, want no reopen during backoff", err, fc.opens)
+	}
+
+	// Device is back
+	fc.readErr = nil
+	fc.openErr = nil
+	time.Sleep(30 * time.Millisecond)
+	err = rc.Write([]byte("QPI\r"))
+	if err != nil {
+		t.Fatalf("Write() error = %v, want reconnect", err)
+	}
+	got, err := rc.ReadUntilCR()
+	if err != nil || string(got) != "(ACK\r" {
+		t.Errorf("ReadUntilCR() got = %q, %v", got, err)
+	}
+
+	want := []State{
+		StateConnecting, StateConnected,
+		StateDisconnected, StateConnecting, StateDisconnected,
+		StateConnecting, StateConnected,
+	}
+	if len(states) != len(want) {
+		t.Fatalf("state changes got = %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("state changes got = %v, want %v", states, want)
+		}
+	}
+}
+
+func TestReconnectConnectorTimeouts(t *testing.T) {
+	fc := &flakyConnector{readErr: context.DeadlineExceeded}
+	rc := NewReconnectConnector(fc, ReconnectConfig{MaxTimeouts: 2})
+	rc.Open()
+
+	rc.ReadUntilCR()
+	if state, _ := rc.State(); state != StateConnected {
+		t.Errorf("State() got = %v after one timeout, want Connected", state)
+	}
+
+	rc.ReadUntilCR()
+	if state, _ := rc.State(); state != StateDisconnected {
+		t.Errorf("State() got = %v after two timeouts, want Disconnected", state)
+	}
+}
+
+func TestReconnectConnectorContextTimeouts(t *testing.T) {
+	rc := NewReconnectConnector(&flakyConnector{}, ReconnectConfig{MaxTimeouts: 2, CountDeadlines: true})
+	rc.Open()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	for _, ctx := range []context.Context{canceled, canceled, expired} {
+		rc.ReadContext(ctx, 0x0d)
+	}
+	if state, _ := rc.State(); state != StateConnected {
+		t.Errorf("State() got = %v after cancellations and one deadline, want Connected", state)
+	}
+
+	rc.ReadContext(expired, 0x0d)
+	if state, _ := rc.State(); state != StateDisconnected {
+		t.Errorf("State() got = %v after two deadlines, want Disconnected", state)
+	}
+}
+
+// Run with -race, the reconnect state is shared by concurrent readers and
+// writers.
+func TestReconnectConnectorConcurrent(t *testing.T) {
+	rc := NewReconnectConnector(NewResponderConnector(ResponderFunc(func(request []byte) []byte {
+		return request
+	})), ReconnectConfig{MinBackoff: time.Millisecond, MaxTimeouts: 1})
+	rc.Open()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rc.Write([]byte("QMOD\r"))
+				rc.ReadUntilCR()
+				if j%10 == 0 {
+					rc.Close()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReconnectConnectorIgnoreDeadlines(t *testing.T) {
+	rc := NewReconnectConnector(&flakyConnector{}, ReconnectConfig{MaxTimeouts: 1})
+	rc.Open()
+
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	rc.ReadContext(expired, 0x0d)
+	rc.ReadContext(expired, 0x0d)
+	if state, _ := rc.State(); state != StateConnected {
+		t.Errorf("State() got = %v after deadlines, want Connected", state)
+	}
+}
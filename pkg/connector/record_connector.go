@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	opWrite = "write"
+	opRead  = "read"
+)
+
+// A single Write or Read on a recorded connector, stored as one JSON line.
+type sessionEvent struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Data  hexBytes  `json:"data,omitempty"`
+	Error string    `json:"error,omitempty"`
+	// Identifies the sentinel error in Error, see sessionErrors
+	Code string `json:"code,omitempty"`
+}
+
+// Sentinel errors stored by code, so that a replayed error still matches
+// them with errors.Is
+var sessionErrors = []struct {
+	code string
+	err  error
+}{
+	{"timeout", ErrTimeout},
+	{"not_open", ErrNotOpen},
+	{"disconnected", ErrDisconnected},
+}
+
+// Returns the code of the sentinel error err matches, deadlines count as
+// ErrTimeout.
+func sessionErrorCode(err error) string {
+	if isTimeout(err) {
+		return "timeout"
+	}
+	for _, se := range sessionErrors {
+		if errors.Is(err, se.err) {
+			return se.code
+		}
+	}
+	return ""
+}
+
+// A recorded error, wrapping the sentinel error of its code.
+type sessionError struct {
+	msg string
+	err error
+}
+
+func (se *sessionError) Error() string {
+	return se.msg
+}
+
+func (se *sessionError) Unwrap() error {
+	return se.err
+}
+
+// Returns the recorded error of the event, nil if it succeeded.
+func (e sessionEvent) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	for _, se := range sessionErrors {
+		if se.code == e.Code {
+			return &sessionError{msg: e.Error, err: se.err}
+		}
+	}
+	return errors.New(e.Error)
+}
+
+// Bytes exchanged with a device are stored as hex, as the binary protocols
+// (e.g. the Axpert CRC) are not valid UTF-8.
+type hexBytes []byte
+
+func (hb hexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(hb)), nil
+}
+
+func (hb *hexBytes) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*hb = b
+	return nil
+}
+
+// RecordConnector passes all calls through to a live connector and records
+// every Write and Read, including failed reads, to a session file that can be
+// served back by a ReplayConnector.
+type RecordConnector struct {
+	conn Connector
+	file *os.File
+	enc  *json.Encoder
+	mu   sync.Mutex
+}
+
+func NewRecordConnector(conn Connector, path string) (*RecordConnector, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordConnector{conn: conn, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (rc *RecordConnector) Connector() Connector {
+	return rc.conn
+}
+
+func (rc *RecordConnector) Open() error {
+	return rc.conn.Open()
+}
+
+func (rc *RecordConnector) Close() {
+	rc.conn.Close()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.file.Close()
+}
+
+func (rc *RecordConnector) ReadUntilCR() ([]byte, error) {
+	return rc.Read(0x0d)
+}
+
+func (rc *RecordConnector) Read(terminator byte) ([]byte, error) {
+	bytesRead, err := rc.conn.Read(terminator)
+	rc.record(opRead, bytesRead, err)
+	return bytesRead, err
+}
+
+func (rc *RecordConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	bytesRead, err := ReadContext(ctx, rc.conn, terminator)
+	rc.record(opRead, bytesRead, err)
+	return bytesRead, err
+}
+
+func (rc *RecordConnector) Write(bytes []byte) error {
+	err := rc.conn.Write(bytes)
+	rc.record(opWrite, bytes, err)
+	return err
+}
+
+func (rc *RecordConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	err := WriteContext(ctx, rc.conn, bytes)
+	rc.record(opWrite, bytes, err)
+	return err
+}
+
+// Recording is best effort, a full disk should not break the live session.
+func (rc *RecordConnector) record(op string, data []byte, err error) {
+	event := sessionEvent{Time: time.Now(), Op: op, Data: data}
+	if err != nil {
+		event.Error = err.Error()
+		event.Code = sessionErrorCode(err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	_ = rc.enc.Encode(event)
+}
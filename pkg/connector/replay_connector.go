@@ -0,0 +1,165 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// A recorded request and the reads that followed it.
+type exchange struct {
+	request  []byte
+	writeErr error
+	reads    []sessionEvent
+}
+
+// ReplayConnector serves a session captured by a RecordConnector.
+//
+// Exchanges are looked up by request, so the order in which different
+// queries are sent does not have to match the recording. Repeating a request
+// returns its recorded responses in order, starting over once they are
+// exhausted, which allows a polling loop to run against a short capture.
+// Reads that were recorded without a preceding write are served in order to
+// reads made before the first write.
+type ReplayConnector struct {
+	path        string
+	exchanges   map[string][]exchange
+	next        map[string]int
+	unsolicited []sessionEvent
+	pending     []sessionEvent
+	mu          sync.Mutex
+}
+
+func NewReplayConnector(path string) (*ReplayConnector, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rc := &ReplayConnector{
+		path:      path,
+		exchanges: make(map[string][]exchange),
+		next:      make(map[string]int),
+	}
+
+	var current *exchange
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event sessionEvent
+		err = json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session %s line %d: %w", path, line, err)
+		}
+
+		switch event.Op {
+		case opWrite:
+			rc.add(current)
+			current = &exchange{request: event.Data, writeErr: event.err()}
+		case opRead:
+			if current == nil {
+				rc.unsolicited = append(rc.unsolicited, event)
+				continue
+			}
+			current.reads = append(current.reads, event)
+		default:
+			return nil, fmt.Errorf("invalid session %s line %d: unknown op %s", path, line, event.Op)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	rc.add(current)
+
+	return rc, nil
+}
+
+func (rc *ReplayConnector) add(ex *exchange) {
+	if ex == nil {
+		return
+	}
+	key := string(ex.request)
+	rc.exchanges[key] = append(rc.exchanges[key], *ex)
+}
+
+func (rc *ReplayConnector) Path() string {
+	return rc.path
+}
+
+func (rc *ReplayConnector) Open() error {
+	return nil
+}
+
+func (rc *ReplayConnector) Close() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.pending = nil
+}
+
+func (rc *ReplayConnector) ReadUntilCR() ([]byte, error) {
+	return rc.Read(0x0d)
+}
+
+func (rc *ReplayConnector) Read(terminator byte) ([]byte, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	var event sessionEvent
+	switch {
+	case len(rc.pending) > 0:
+		event = rc.pending[0]
+		rc.pending = rc.pending[1:]
+	case len(rc.unsolicited) > 0:
+		event = rc.unsolicited[0]
+		rc.unsolicited = rc.unsolicited[1:]
+	default:
+		return nil, fmt.Errorf("no recorded response in %s", rc.path)
+	}
+
+	if err := event.err(); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), event.Data...), nil
+}
+
+func (rc *ReplayConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rc.Read(terminator)
+}
+
+func (rc *ReplayConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rc.Write(bytes)
+}
+
+func (rc *ReplayConnector) Write(bytes []byte) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	key := string(bytes)
+	exchanges, ok := rc.exchanges[key]
+	if !ok {
+		return fmt.Errorf("no recorded exchange for request %q in %s", bytes, rc.path)
+	}
+
+	i := rc.next[key] % len(exchanges)
+	rc.next[key] = i + 1
+	rc.pending = exchanges[i].reads
+	rc.unsolicited = nil
+	if exchanges[i].writeErr != nil {
+		return exchanges[i].writeErr
+	}
+	return nil
+}
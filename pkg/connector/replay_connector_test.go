@@ -0,0 +1,154 @@
+package connector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Answers each written request with the responses queued for it.
+type scriptedConnector struct {
+	responses map[string][]string
+	pending   []string
+}
+
+func (sc *scriptedConnector) Open() error { return nil }
+
+func (sc *scriptedConnector) Close() {}
+
+func (sc *scriptedConnector) ReadUntilCR() ([]byte, error) {
+	return sc.Read(0x0d)
+}
+
+func (sc *scriptedConnector) Read(terminator byte) ([]byte, error) {
+	if len(sc.pending) == 0 {
+		return nil, errors.New("timeout")
+	}
+	resp := sc.pending[0]
+	sc.pending = sc.pending[1:]
+	return []byte(resp), nil
+}
+
+func (sc *scriptedConnector) Write(bytes []byte) error {
+	sc.pending = sc.responses[string(bytes)]
+	return nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	live := &scriptedConnector{responses: map[string][]string{
+		"QMOD\r": {"(L\xff\r"},
+		"QID\r":  {"(123\r"},
+	}}
+
+	rc, err := NewRecordConnector(live, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Write([]byte("QMOD\r"))
+	rc.ReadUntilCR()
+	rc.Write([]byte("QID\r"))
+	rc.ReadUntilCR()
+	rc.ReadUntilCR()
+	live.responses["QMOD\r"] = []string{"(B\xff\r"}
+	rc.Write([]byte("QMOD\r"))
+	rc.ReadUntilCR()
+	rc.Close()
+
+	replay, err := NewReplayConnector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+		wantErr bool
+	}{
+		{name: "First QMOD", request: "QMOD\r", want: "(L\xff\r"},
+		{name: "Out of order QID", request: "QID\r", want: "(123\r"},
+		{name: "Second QMOD", request: "QMOD\r", want: "(B\xff\r"},
+		{name: "QMOD starts over", request: "QMOD\r", want: "(L\xff\r"},
+		{name: "Unknown request", request: "QPI\r", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := replay.Write([]byte(tt.request))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := replay.ReadUntilCR()
+			if err != nil {
+				t.Fatalf("ReadUntilCR() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ReadUntilCR() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The recorded read failure after QID is replayed as an error
+	replay.Write([]byte("QID\r"))
+	replay.ReadUntilCR()
+	_, err = replay.ReadUntilCR()
+	if err == nil || err.Error() != "timeout" {
+		t.Errorf("ReadUntilCR() error = %v, want recorded timeout", err)
+	}
+}
+
+// Fails every call with the given errors.
+type failingConnector struct {
+	readErr  error
+	writeErr error
+}
+
+func (fc *failingConnector) Open() error { return nil }
+
+func (fc *failingConnector) Close() {}
+
+func (fc *failingConnector) ReadUntilCR() ([]byte, error) {
+	return fc.Read(0x0d)
+}
+
+func (fc *failingConnector) Read(terminator byte) ([]byte, error) {
+	return nil, fc.readErr
+}
+
+func (fc *failingConnector) Write(bytes []byte) error {
+	return fc.writeErr
+}
+
+func TestReplaySentinelErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	live := &failingConnector{readErr: os.ErrDeadlineExceeded}
+	rc, err := NewRecordConnector(live, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Write([]byte("QMOD\r"))
+	rc.ReadUntilCR()
+	live.writeErr = ErrNotOpen
+	rc.Write([]byte("QID\r"))
+	rc.Close()
+
+	replay, err := NewReplayConnector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay.Write([]byte("QMOD\r"))
+	_, err = replay.ReadUntilCR()
+	if !errors.Is(err, ErrTimeout) || err.Error() != os.ErrDeadlineExceeded.Error() {
+		t.Errorf("ReadUntilCR() error = %v, want recorded %v", err, ErrTimeout)
+	}
+	err = replay.Write([]byte("QID\r"))
+	if !errors.Is(err, ErrNotOpen) {
+		t.Errorf("Write() error = %v, want recorded %v", err, ErrNotOpen)
+	}
+}
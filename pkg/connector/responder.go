@@ -0,0 +1,131 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Responder answers complete request frames, as done by the device
+// simulators. A nil response leaves the request unanswered.
+type Responder interface {
+	Respond(request []byte) []byte
+}
+
+type ResponderFunc func(request []byte) []byte
+
+func (f ResponderFunc) Respond(request []byte) []byte {
+	return f(request)
+}
+
+// ResponderConnector is an in-memory connector answering every write with
+// the response of a Responder.
+type ResponderConnector struct {
+	responder Responder
+	mu        sync.Mutex
+	pending   []byte
+}
+
+func NewResponderConnector(r Responder) *ResponderConnector {
+	return &ResponderConnector{responder: r}
+}
+
+func (rc *ResponderConnector) Open() error {
+	return nil
+}
+
+func (rc *ResponderConnector) Close() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.pending = nil
+}
+
+func (rc *ResponderConnector) ReadUntilCR() ([]byte, error) {
+	return rc.Read(0x0d)
+}
+
+// Returns the pending response up to and including terminator. Reading an
+// unanswered request fails immediately with a timeout, as nothing will
+// arrive.
+func (rc *ResponderConnector) Read(terminator byte) ([]byte, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	i := bytes.IndexByte(rc.pending, terminator)
+	if i < 0 {
+		rc.pending = nil
+		return nil, fmt.Errorf("%w, no response", ErrTimeout)
+	}
+	bytesRead := rc.pending[:i+1]
+	rc.pending = rc.pending[i+1:]
+	return bytesRead, nil
+}
+
+func (rc *ResponderConnector) Write(bytes []byte) error {
+	resp := rc.responder.Respond(bytes)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.pending = append(rc.pending[:0:0], resp...)
+	return nil
+}
+
+// Answers requests read from rw, each ending with terminator, until ctx is
+// done or rw is closed.
+func Serve(ctx context.Context, rw io.ReadWriter, terminator byte, r Responder) error {
+	if c, ok := rw.(io.Closer); ok {
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+		defer stop()
+	}
+
+	reader := bufio.NewReader(rw)
+	for {
+		req, err := reader.ReadBytes(terminator)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		resp := r.Respond(req)
+		if resp == nil {
+			continue
+		}
+		_, err = rw.Write(resp)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Serves every connection accepted on l with r until ctx is done.
+func ServeListener(ctx context.Context, l net.Listener, terminator byte, r Responder) error {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			Serve(ctx, conn, terminator, r)
+		}()
+	}
+}
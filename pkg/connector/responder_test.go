@@ -0,0 +1,80 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// Answers every request with its reverse, and ignores "drop\r".
+type reverseResponder struct{}
+
+func (reverseResponder) Respond(request []byte) []byte {
+	if string(request) == "drop\r" {
+		return nil
+	}
+	body := request[:len(request)-1]
+	resp := make([]byte, 0, len(request))
+	for i := len(body) - 1; i >= 0; i-- {
+		resp = append(resp, body[i])
+	}
+	return append(resp, 0x0d)
+}
+
+func TestResponderConnector(t *testing.T) {
+	c := NewResponderConnector(reverseResponder{})
+
+	c.Write([]byte("QPI\r"))
+	got, err := c.ReadUntilCR()
+	if err != nil || string(got) != "IPQ\r" {
+		t.Errorf("ReadUntilCR() got = %q, %v", got, err)
+	}
+
+	c.Write([]byte("drop\r"))
+	_, err = c.ReadUntilCR()
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("ReadUntilCR() error = %v, want timeout", err)
+	}
+}
+
+func TestServeListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ServeListener(ctx, l, 0x0d, reverseResponder{})
+	}()
+
+	tc := NewTCPConnector(TCPConfig{Address: l.Addr().String(), Timeout: time.Second})
+	err = tc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	for _, req := range []string{"drop\r", "QMOD\r", "QPIGS\r"} {
+		tc.Write([]byte(req))
+	}
+	for _, want := range []string{"DOMQ\r", "SGIPQ\r"} {
+		got, err := tc.ReadUntilCR()
+		if err != nil || !bytes.Equal(got, []byte(want)) {
+			t.Errorf("ReadUntilCR() got = %q, %v, want %q", got, err, want)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("ServeListener() error = %v, want canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("ServeListener() did not return after cancel")
+	}
+}
@@ -1,18 +1,24 @@
 package connector
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/goburrow/serial"
 )
 
+// The port is polled at this interval so a read can be cancelled without
+// waiting for the configured timeout.
+const serialPollInterval = 100 * time.Millisecond
+
 type SerialConnector struct {
-	config  serial.Config
-	port    serial.Port
-	scanner *bufio.Scanner
+	config serial.Config
+	port   serial.Port
+	buffer []byte
 }
 
 func NewSerialConnector(config serial.Config) *SerialConnector {
@@ -32,30 +38,16 @@ func (sc *SerialConnector) Open() error {
 		return nil
 	}
 
-	port, err := serial.Open(&sc.config)
+	// The configured timeout applies to a whole read, see Read
+	portConfig := sc.config
+	portConfig.Timeout = serialPollInterval
+
+	port, err := serial.Open(&portConfig)
 	if err != nil {
 		return err
 	}
 	sc.port = port
-
-	sc.scanner = bufio.NewScanner(port)
-	split := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF && len(data) == 0 {
-			return 0, nil, nil
-		}
-		if i := bytes.IndexByte(data, '\r'); i >= 0 {
-			// We have a full message
-			return i + 1, data[0 : i+1], nil
-		}
-		// If we're at EOF, we return whatever we have
-		if atEOF {
-			return len(data), data, nil
-		}
-		// Otherwise, request more data.
-		return 0, nil, nil
-	}
-	// Set the split function for the scanning operation.
-	sc.scanner.Split(split)
+	sc.buffer = nil
 
 	return nil
 }
@@ -70,17 +62,57 @@ func (sc *SerialConnector) ReadUntilCR() ([]byte, error) {
 }
 
 func (sc *SerialConnector) Read(terminator byte) ([]byte, error) {
-	if sc.scanner.Scan() {
-		bytesRead := sc.scanner.Bytes()
-		return bytesRead, nil
+	return sc.ReadContext(context.Background(), terminator)
+}
+
+// Reads until terminator, giving up at the earlier of the configured timeout
+// and the ctx deadline.
+func (sc *SerialConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	if sc.port == nil {
+		return nil, fmt.Errorf("serial port %s is %w", sc.config.Address, ErrNotOpen)
+	}
+	if sc.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sc.config.Timeout)
+		defer cancel()
 	}
-	if err := sc.scanner.Err(); err != nil {
-		return nil, err
+
+	chunk := make([]byte, 64)
+	for {
+		if i := bytes.IndexByte(sc.buffer, terminator); i >= 0 {
+			// We have a full message
+			bytesRead := append([]byte(nil), sc.buffer[:i+1]...)
+			sc.buffer = sc.buffer[i+1:]
+			return bytesRead, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, timeoutError(err)
+		}
+
+		n, err := sc.port.Read(chunk)
+		sc.buffer = append(sc.buffer, chunk[:n]...)
+		if err != nil && !errors.Is(err, serial.ErrTimeout) {
+			return nil, err
+		}
+		if n == 0 && err == nil {
+			return nil, io.EOF
+		}
 	}
-	return nil, io.EOF
 }
 
 func (sc *SerialConnector) Write(bytes []byte) error {
+	return sc.WriteContext(context.Background(), bytes)
+}
+
+// Any unread input, e.g. the late response to a cancelled request, is
+// discarded before writing.
+func (sc *SerialConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sc.buffer = nil
+
 	n, err := sc.port.Write(bytes)
 	if n != len(bytes) {
 		return fmt.Errorf("write incomplete, %d of %d written", n, len(bytes))
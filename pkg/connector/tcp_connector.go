@@ -0,0 +1,324 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Telnet and RFC 2217 (COM-PORT-OPTION) protocol bytes
+const (
+	telnetSE   byte = 240
+	telnetSB   byte = 250
+	telnetWill byte = 251
+	telnetWont byte = 252
+	telnetDo   byte = 253
+	telnetDont byte = 254
+	telnetIAC  byte = 255
+
+	telnetBinary     byte = 0
+	telnetComPortOpt byte = 44
+
+	comPortSetBaudRate byte = 1
+	comPortSetDataSize byte = 2
+	comPortSetParity   byte = 3
+	comPortSetStopSize byte = 4
+)
+
+// TCPConfig describes a serial port exposed by a serial-over-IP gateway.
+// The line settings are only sent to the gateway when RFC2217 is set, raw
+// socket gateways are expected to be configured for the right baud rate.
+type TCPConfig struct {
+	Address  string
+	RFC2217  bool
+	BaudRate int
+	DataBits int
+	StopBits int
+	Parity   string
+	Timeout  time.Duration
+}
+
+type TCPConnector struct {
+	config TCPConfig
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewTCPConnector(config TCPConfig) *TCPConnector {
+	return &TCPConnector{config: config}
+}
+
+func (tc *TCPConnector) Config() TCPConfig {
+	return tc.config
+}
+
+func (tc *TCPConnector) Open() error {
+	if tc.conn != nil {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", tc.config.Address, tc.dialTimeout())
+	if err != nil {
+		return err
+	}
+	tc.conn = conn
+
+	if !tc.config.RFC2217 {
+		tc.reader = bufio.NewReader(conn)
+		return nil
+	}
+
+	tc.reader = bufio.NewReader(&telnetReader{conn: conn})
+	err = tc.negotiate()
+	if err != nil {
+		tc.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (tc *TCPConnector) Close() {
+	if tc.conn == nil {
+		return
+	}
+	tc.conn.Close()
+	tc.conn = nil
+	tc.reader = nil
+}
+
+func (tc *TCPConnector) ReadUntilCR() ([]byte, error) {
+	return tc.Read(0x0d)
+}
+
+func (tc *TCPConnector) Read(terminator byte) ([]byte, error) {
+	return tc.ReadContext(context.Background(), terminator)
+}
+
+func (tc *TCPConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	if tc.conn == nil {
+		return nil, fmt.Errorf("connection to %s is %w", tc.config.Address, ErrNotOpen)
+	}
+
+	stop, err := tc.bind(ctx, tc.conn.SetReadDeadline)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	bytesRead, err := tc.reader.ReadBytes(terminator)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, timeoutError(ctx.Err())
+		}
+		return nil, timeoutError(err)
+	}
+	return bytesRead, nil
+}
+
+func (tc *TCPConnector) Write(bytes []byte) error {
+	return tc.WriteContext(context.Background(), bytes)
+}
+
+func (tc *TCPConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	if tc.conn == nil {
+		return fmt.Errorf("connection to %s is %w", tc.config.Address, ErrNotOpen)
+	}
+
+	if tc.config.RFC2217 {
+		bytes = escapeIAC(bytes)
+	}
+
+	stop, err := tc.bind(ctx, tc.conn.SetWriteDeadline)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	n, err := tc.conn.Write(bytes)
+	if err != nil {
+		if ctx.Err() != nil {
+			return timeoutError(ctx.Err())
+		}
+		return timeoutError(err)
+	}
+	if n != len(bytes) {
+		return fmt.Errorf("write incomplete, %d of %d written", n, len(bytes))
+	}
+	return nil
+}
+
+// Sets the deadline to the earliest of the configured timeout and the ctx
+// deadline, and moves it to now when ctx is cancelled. The returned function
+// stops watching ctx.
+func (tc *TCPConnector) bind(ctx context.Context, setDeadline func(time.Time) error) (func() bool, error) {
+	var deadline time.Time
+	if tc.config.Timeout > 0 {
+		deadline = time.Now().Add(tc.config.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+
+	err := setDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	return context.AfterFunc(ctx, func() {
+		setDeadline(time.Now())
+	}), nil
+}
+
+func (tc *TCPConnector) dialTimeout() time.Duration {
+	if tc.config.Timeout > 0 {
+		return tc.config.Timeout
+	}
+	return 30 * time.Second
+}
+
+// Announces binary transmission and the COM-PORT-OPTION to the gateway and
+// sends the configured line settings.
+func (tc *TCPConnector) negotiate() error {
+	req := []byte{
+		telnetIAC, telnetWill, telnetBinary,
+		telnetIAC, telnetDo, telnetBinary,
+		telnetIAC, telnetWill, telnetComPortOpt,
+	}
+
+	if tc.config.BaudRate > 0 {
+		baud := make([]byte, 4)
+		binary.BigEndian.PutUint32(baud, uint32(tc.config.BaudRate))
+		req = append(req, comPortCommand(comPortSetBaudRate, baud...)...)
+	}
+	if tc.config.DataBits > 0 {
+		req = append(req, comPortCommand(comPortSetDataSize, byte(tc.config.DataBits))...)
+	}
+	if tc.config.Parity != "" {
+		parity, err := comPortParity(tc.config.Parity)
+		if err != nil {
+			return err
+		}
+		req = append(req, comPortCommand(comPortSetParity, parity)...)
+	}
+	if tc.config.StopBits > 0 {
+		req = append(req, comPortCommand(comPortSetStopSize, byte(tc.config.StopBits))...)
+	}
+
+	_, err := tc.conn.Write(req)
+	return err
+}
+
+func comPortCommand(cmd byte, value ...byte) []byte {
+	sub := []byte{telnetIAC, telnetSB, telnetComPortOpt, cmd}
+	sub = append(sub, escapeIAC(value)...)
+	return append(sub, telnetIAC, telnetSE)
+}
+
+func comPortParity(parity string) (byte, error) {
+	switch parity {
+	case "N":
+		return 1, nil
+	case "O":
+		return 2, nil
+	case "E":
+		return 3, nil
+	}
+	return 0, fmt.Errorf("unsupported parity %s", parity)
+}
+
+func escapeIAC(data []byte) []byte {
+	escaped := make([]byte, 0, len(data))
+	for _, b := range data {
+		escaped = append(escaped, b)
+		if b == telnetIAC {
+			escaped = append(escaped, telnetIAC)
+		}
+	}
+	return escaped
+}
+
+// telnetReader strips telnet commands from the data received from an
+// RFC 2217 gateway and refuses any option other than the ones we requested.
+type telnetReader struct {
+	conn  net.Conn
+	state byte
+	cmd   byte
+}
+
+const (
+	telnetStateData byte = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSub
+	telnetStateSubIAC
+)
+
+func (tr *telnetReader) Read(p []byte) (int, error) {
+	for {
+		n, err := tr.conn.Read(p)
+		data := tr.filter(p[:n])
+		if len(data) > 0 || err != nil {
+			return len(data), err
+		}
+	}
+}
+
+// Filters the data in place, returning the part of in that holds payload bytes.
+func (tr *telnetReader) filter(in []byte) []byte {
+	out := in[:0]
+	for _, b := range in {
+		switch tr.state {
+		case telnetStateData:
+			if b == telnetIAC {
+				tr.state = telnetStateIAC
+				continue
+			}
+			out = append(out, b)
+		case telnetStateIAC:
+			switch b {
+			case telnetIAC:
+				out = append(out, b)
+				tr.state = telnetStateData
+			case telnetWill, telnetWont, telnetDo, telnetDont:
+				tr.cmd = b
+				tr.state = telnetStateOption
+			case telnetSB:
+				tr.state = telnetStateSub
+			default:
+				tr.state = telnetStateData
+			}
+		case telnetStateOption:
+			tr.reply(tr.cmd, b)
+			tr.state = telnetStateData
+		case telnetStateSub:
+			// Responses to COM-PORT-OPTION commands are ignored
+			if b == telnetIAC {
+				tr.state = telnetStateSubIAC
+			}
+		case telnetStateSubIAC:
+			if b == telnetSE {
+				tr.state = telnetStateData
+			} else {
+				tr.state = telnetStateSub
+			}
+		}
+	}
+	return out
+}
+
+func (tr *telnetReader) reply(cmd byte, option byte) {
+	if option == telnetBinary || option == telnetComPortOpt {
+		return
+	}
+
+	switch cmd {
+	case telnetWill:
+		tr.conn.Write([]byte{telnetIAC, telnetDont, option})
+	case telnetDo:
+		tr.conn.Write([]byte{telnetIAC, telnetWont, option})
+	}
+}
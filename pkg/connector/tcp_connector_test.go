@@ -0,0 +1,182 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Starts a single connection gateway stand-in on localhost and hands the
+// accepted connection to serve.
+func listen(t *testing.T, serve func(conn net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+
+	return l.Addr().String()
+}
+
+func TestTCPConnectorRaw(t *testing.T) {
+	address := listen(t, func(conn net.Conn) {
+		req, err := bufio.NewReader(conn).ReadBytes('\r')
+		if err != nil {
+			return
+		}
+		if string(req) == "QPI\xbe\xac\r" {
+			conn.Write([]byte("(PI30\x9a\x0b\r"))
+		}
+	})
+
+	tc := NewTCPConnector(TCPConfig{Address: address, Timeout: time.Second})
+	err := tc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	err = tc.Write([]byte("QPI\xbe\xac\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tc.ReadUntilCR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "(PI30\x9a\x0b\r" {
+		t.Errorf("ReadUntilCR() got = %q", got)
+	}
+}
+
+func TestTCPConnectorTimeout(t *testing.T) {
+	address := listen(t, func(conn net.Conn) {
+		time.Sleep(500 * time.Millisecond)
+	})
+
+	tc := NewTCPConnector(TCPConfig{Address: address, Timeout: 50 * time.Millisecond})
+	err := tc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	_, err = tc.ReadUntilCR()
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("ReadUntilCR() error = %v, want %v", err, ErrTimeout)
+	}
+}
+
+func TestTCPConnectorRFC2217(t *testing.T) {
+	negotiation := make(chan []byte, 1)
+	written := make(chan []byte, 1)
+
+	address := listen(t, func(conn net.Conn) {
+		// Option announcements followed by the four line setting commands
+		buf := make([]byte, 9+10+3*7)
+		_, err := io.ReadFull(conn, buf)
+		if err != nil {
+			return
+		}
+		negotiation <- buf
+
+		// Unsolicited option, escaped 0xFF data byte and a COM-PORT-OPTION reply
+		conn.Write([]byte{
+			telnetIAC, telnetDo, 1,
+			'~', '2', telnetIAC, telnetIAC,
+			telnetIAC, telnetSB, telnetComPortOpt, 101, 0, 0, 0x04, 0xB0, telnetIAC, telnetSE,
+			'0', '\r',
+		})
+
+		buf = make([]byte, 7)
+		_, err = io.ReadFull(conn, buf)
+		if err != nil {
+			return
+		}
+		written <- buf
+	})
+
+	tc := NewTCPConnector(TCPConfig{
+		Address:  address,
+		RFC2217:  true,
+		BaudRate: 1200,
+		DataBits: 8,
+		StopBits: 1,
+		Parity:   "N",
+		Timeout:  time.Second,
+	})
+	err := tc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	got := <-negotiation
+	wantBaud := []byte{telnetIAC, telnetSB, telnetComPortOpt, comPortSetBaudRate, 0, 0, 0x04, 0xB0, telnetIAC, telnetSE}
+	if !bytes.Contains(got, wantBaud) {
+		t.Errorf("negotiation got = %v, want baud rate command %v", got, wantBaud)
+	}
+	wantParity := []byte{telnetIAC, telnetSB, telnetComPortOpt, comPortSetParity, 1, telnetIAC, telnetSE}
+	if !bytes.Contains(got, wantParity) {
+		t.Errorf("negotiation got = %v, want parity command %v", got, wantParity)
+	}
+
+	read, err := tc.ReadUntilCR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, []byte{'~', '2', 0xFF, '0', '\r'}) {
+		t.Errorf("ReadUntilCR() got = %v", read)
+	}
+
+	err = tc.Write([]byte{'~', 0xFF, '\r'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The refusal of the unsolicited option precedes the escaped payload
+	want := []byte{telnetIAC, telnetWont, 1, '~', telnetIAC, telnetIAC, '\r'}
+	if w := <-written; !bytes.Equal(w, want) {
+		t.Errorf("Write() sent = %v, want %v", w, want)
+	}
+}
+
+func TestTCPConnectorReadContextCancel(t *testing.T) {
+	address := listen(t, func(conn net.Conn) {
+		time.Sleep(2 * time.Second)
+	})
+
+	tc := NewTCPConnector(TCPConfig{Address: address, Timeout: 10 * time.Second})
+	err := tc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = tc.ReadContext(ctx, '\r')
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadContext() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ReadContext() returned after %v, want prompt return on cancel", elapsed)
+	}
+}
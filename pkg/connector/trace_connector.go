@@ -0,0 +1,147 @@
+package connector
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceEvent describes a single Write or Read on a traced connector.
+type TraceEvent struct {
+	Time time.Time
+	Op   string
+	Data []byte
+	// For reads, the time since the preceding write
+	Latency time.Duration
+	Err     error
+	// Protocol specific description of the framing, if a decoder is set
+	Frame string
+}
+
+type TraceSink interface {
+	Trace(event TraceEvent)
+}
+
+type TraceSinkFunc func(event TraceEvent)
+
+func (f TraceSinkFunc) Trace(event TraceEvent) {
+	f(event)
+}
+
+// Decodes the framing of a request or response, e.g. checksums and lengths,
+// into a human-readable description.
+type FrameDecoder func(data []byte) string
+
+// TraceConnector passes all calls through to a connector and, while
+// enabled, reports every Write and Read to a sink.
+type TraceConnector struct {
+	conn      Connector
+	sink      TraceSink
+	decode    FrameDecoder
+	enabled   atomic.Bool
+	lastWrite time.Time
+}
+
+// Returns a connector tracing to sink, decoding frames with decode if it is
+// not nil. Tracing is enabled initially.
+func NewTraceConnector(conn Connector, sink TraceSink, decode FrameDecoder) *TraceConnector {
+	tc := &TraceConnector{conn: conn, sink: sink, decode: decode}
+	tc.enabled.Store(true)
+	return tc
+}
+
+func (tc *TraceConnector) Connector() Connector {
+	return tc.conn
+}
+
+// Enables or disables tracing, safe to call while the connector is in use.
+func (tc *TraceConnector) SetEnabled(enabled bool) {
+	tc.enabled.Store(enabled)
+}
+
+func (tc *TraceConnector) Enabled() bool {
+	return tc.enabled.Load()
+}
+
+func (tc *TraceConnector) Open() error {
+	return tc.conn.Open()
+}
+
+func (tc *TraceConnector) Close() {
+	tc.conn.Close()
+}
+
+func (tc *TraceConnector) ReadUntilCR() ([]byte, error) {
+	return tc.Read(0x0d)
+}
+
+func (tc *TraceConnector) Read(terminator byte) ([]byte, error) {
+	return tc.ReadContext(context.Background(), terminator)
+}
+
+func (tc *TraceConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	bytesRead, err := ReadContext(ctx, tc.conn, terminator)
+	tc.trace(opRead, bytesRead, err)
+	return bytesRead, err
+}
+
+func (tc *TraceConnector) Write(bytes []byte) error {
+	return tc.WriteContext(context.Background(), bytes)
+}
+
+func (tc *TraceConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	err := WriteContext(ctx, tc.conn, bytes)
+	tc.trace(opWrite, bytes, err)
+	return err
+}
+
+func (tc *TraceConnector) trace(op string, data []byte, err error) {
+	now := time.Now()
+	event := TraceEvent{Time: now, Op: op, Data: data, Err: err}
+
+	switch op {
+	case opWrite:
+		tc.lastWrite = now
+	case opRead:
+		if !tc.lastWrite.IsZero() {
+			event.Latency = now.Sub(tc.lastWrite)
+		}
+	}
+
+	if !tc.enabled.Load() {
+		return
+	}
+	if tc.decode != nil && len(data) > 0 {
+		event.Frame = tc.decode(data)
+	}
+	tc.sink.Trace(event)
+}
+
+// Returns a sink writing a summary line followed by a hex and ASCII dump of
+// every event to w.
+func NewWriterSink(w io.Writer) TraceSink {
+	var mu sync.Mutex
+	return TraceSinkFunc(func(event TraceEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fmt.Fprintf(w, "%s %-5s %d bytes", event.Time.Format("2006-01-02T15:04:05.000Z07:00"), event.Op, len(event.Data))
+		if event.Latency > 0 {
+			fmt.Fprintf(w, " after %v", event.Latency.Round(time.Microsecond))
+		}
+		if event.Frame != "" {
+			fmt.Fprintf(w, " %s", event.Frame)
+		}
+		if event.Err != nil {
+			fmt.Fprintf(w, " error: %v", event.Err)
+		}
+		fmt.Fprintln(w)
+		if len(event.Data) > 0 {
+			fmt.Fprint(w, hex.Dump(event.Data))
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTraceConnector(t *testing.T) {
+	live := &scriptedConnector{responses: map[string][]string{
+		"QMOD\r": {"(L\r"},
+	}}
+
+	var events []TraceEvent
+	tc := NewTraceConnector(live, TraceSinkFunc(func(event TraceEvent) {
+		events = append(events, event)
+	}), func(data []byte) string {
+		return "len=" + string(rune('0'+len(data)))
+	})
+
+	tc.Write([]byte("QMOD\r"))
+	tc.ReadUntilCR()
+	tc.SetEnabled(false)
+	tc.Write([]byte("QMOD\r"))
+	tc.ReadUntilCR()
+	tc.SetEnabled(true)
+	tc.ReadUntilCR()
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	if events[0].Op != opWrite || events[0].Frame != "len=5" {
+		t.Errorf("events[0] got = %+v, want write with frame", events[0])
+	}
+	if events[1].Op != opRead || string(events[1].Data) != "(L\r" || events[1].Latency <= 0 {
+		t.Errorf("events[1] got = %+v, want read with latency", events[1])
+	}
+	if events[2].Err == nil {
+		t.Errorf("events[2] got = %+v, want read error", events[2])
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	live := &scriptedConnector{responses: map[string][]string{"QPI\r": {"(PI30\r"}}}
+	tc := NewTraceConnector(live, NewWriterSink(&buf), nil)
+
+	tc.Write([]byte("QPI\r"))
+	tc.ReadUntilCR()
+
+	out := buf.String()
+	for _, want := range []string{"write 4 bytes", "read  6 bytes after", "|QPI.|", "|(PI30.|"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
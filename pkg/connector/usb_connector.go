@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -8,9 +9,15 @@ import (
 	"github.com/sstallion/go-hid"
 )
 
+const (
+	defaultUSBTimeout = 5 * time.Second
+	usbPollInterval   = 100 * time.Millisecond
+)
+
 type USBConnector struct {
 	deviceInfo *hid.DeviceInfo
 	device     *hid.Device
+	timeout    time.Duration
 }
 
 func GetUSBPaths() (paths []string, err error) {
@@ -27,6 +34,25 @@ func GetUSBPaths() (paths []string, err error) {
 	return paths, nil
 }
 
+// Returns the path of the first device matching the vendor ID, product ID
+// and serial number of info.
+func findUSBPath(info *hid.DeviceInfo) (path string, err error) {
+	err = hid.Enumerate(info.VendorID, info.ProductID, func(candidate *hid.DeviceInfo) error {
+		if path == "" && candidate.SerialNbr == info.SerialNbr {
+			path = candidate.Path
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("no device %04x:%04x found", info.VendorID, info.ProductID)
+	}
+
+	return path, nil
+}
+
 func NewUSBConnector(path string) (uc *USBConnector, err error) {
 	device, err := hid.OpenPath(path)
 	if err != nil {
@@ -38,7 +64,13 @@ func NewUSBConnector(path string) (uc *USBConnector, err error) {
 		return nil, err
 	}
 
-	return &USBConnector{deviceInfo: deviceInfo, device: device}, nil
+	return &USBConnector{deviceInfo: deviceInfo, device: device, timeout: defaultUSBTimeout}, nil
+}
+
+// Sets the timeout of reads, defaults to 5 seconds. ReadContext gives up at
+// the earlier of the timeout and the ctx deadline.
+func (uc *USBConnector) SetTimeout(timeout time.Duration) {
+	uc.timeout = timeout
 }
 
 func (uc *USBConnector) DeviceInfo() *hid.DeviceInfo {
@@ -49,12 +81,42 @@ func (uc *USBConnector) Path() string {
 	return uc.deviceInfo.Path
 }
 
+// Reopens a closed device. When the device is no longer at its path, e.g.
+// after it was unplugged or the USB bus was reset, it is looked up again by
+// vendor ID, product ID and serial number.
 func (uc *USBConnector) Open() error {
-	// Device is already open - no need to open
+	if uc.device != nil {
+		// Device is already open - no need to open
+		return nil
+	}
+
+	device, err := hid.OpenPath(uc.deviceInfo.Path)
+	if err != nil {
+		path, ferr := findUSBPath(uc.deviceInfo)
+		if ferr != nil {
+			return fmt.Errorf("failed to reopen %s: %w", uc.deviceInfo.Path, err)
+		}
+		device, err = hid.OpenPath(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	deviceInfo, err := device.GetDeviceInfo()
+	if err != nil {
+		device.Close()
+		return err
+	}
+
+	uc.device = device
+	uc.deviceInfo = deviceInfo
 	return nil
 }
 
 func (uc *USBConnector) Close() {
+	if uc.device == nil {
+		return
+	}
 	uc.device.Close()
 	uc.device = nil
 }
@@ -63,57 +125,64 @@ func (uc *USBConnector) ReadUntilCR() ([]byte, error) {
 	return uc.Read(0x0d)
 }
 
-// TODO This should take timout as argument or set by config
 func (uc *USBConnector) Read(terminator byte) ([]byte, error) {
-	bytesRead := make([]byte, 0, 8)
-	buffer := make([]byte, 64) // HID report buffer
-	timeout := 5 * time.Second
+	return uc.ReadContext(context.Background(), terminator)
+}
 
-	// Create channels for communication with the read goroutine
-	type readResult struct {
-		data []byte
-		n    int
-		err  error
+// Reads HID reports until one contains terminator. The device is polled
+// rather than read in a separate goroutine, so no read is left running once
+// ctx is done.
+func (uc *USBConnector) ReadContext(ctx context.Context, terminator byte) ([]byte, error) {
+	if uc.device == nil {
+		return nil, fmt.Errorf("HID device is %w", ErrNotOpen)
+	}
+	if uc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, uc.timeout)
+		defer cancel()
 	}
-	resultCh := make(chan readResult, 1)
 
-	// Start a goroutine to perform the blocking read
-	go func() {
-		n, err := uc.device.Read(buffer)
-		resultCh <- readResult{data: buffer, n: n, err: err}
-	}()
+	bytesRead := make([]byte, 0, 8)
+	buffer := make([]byte, 64) // HID report buffer
 
 	for {
-		select {
-		case result := <-resultCh:
-			if result.err != nil {
-				return nil, fmt.Errorf("failed to read from HID device: %w", result.err)
-			}
-
-			// Process the read bytes
-			for i := 0; i < result.n; i++ {
-				b := result.data[i]
-				if b > 0 {
-					bytesRead = append(bytesRead, b)
-				}
-				if b == terminator {
-					return bytesRead, nil
-				}
-			}
+		if ctx.Err() != nil {
+			return nil, timeoutError(fmt.Errorf("reading HID: %w", ctx.Err()))
+		}
 
-			// If we haven't found the terminator, start another read
-			go func() {
-				n, err := uc.device.Read(buffer)
-				resultCh <- readResult{data: buffer, n: n, err: err}
-			}()
+		n, err := uc.device.ReadWithTimeout(buffer, usbPollInterval)
+		if errors.Is(err, hid.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from HID device: %w", err)
+		}
 
-		case <-time.After(timeout):
-			return nil, errors.New("timeout reading HID")
+		// Process the read bytes
+		for i := 0; i < n; i++ {
+			b := buffer[i]
+			if b > 0 {
+				bytesRead = append(bytesRead, b)
+			}
+			if b == terminator {
+				return bytesRead, nil
+			}
 		}
 	}
 }
 
 func (uc *USBConnector) Write(bytes []byte) error {
+	return uc.WriteContext(context.Background(), bytes)
+}
+
+func (uc *USBConnector) WriteContext(ctx context.Context, bytes []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if uc.device == nil {
+		return fmt.Errorf("HID device is %w", ErrNotOpen)
+	}
+
 	_, err := uc.device.Write(bytes)
 	if err != nil {
 		return err
@@ -0,0 +1,145 @@
+package pylontech
+
+import "math"
+
+// PackAnalytics are values derived from the BatteryStatus of a pack.
+// Voltages are in V, temperatures in °C and power in W, positive while
+// charging. Cell indices count from 0, as in BatteryStatus.CellVoltage.
+type PackAnalytics struct {
+	// State of charge in percent
+	SOC             float32
+	MinCellVoltage  float32
+	MinCellIndex    int
+	MaxCellVoltage  float32
+	MaxCellIndex    int
+	MeanCellVoltage float32
+	// Difference between the highest and lowest cell voltage
+	CellImbalance     float32
+	MinTemperature    float32
+	MaxTemperature    float32
+	TemperatureSpread float32
+	Power             float32
+}
+
+func (bs *BatteryStatus) Analytics() PackAnalytics {
+	pa := PackAnalytics{
+		SOC:   soc(bs.RemainingCapacity, bs.TotalCapacity),
+		Power: bs.TotalVoltage * bs.Current,
+	}
+
+	if len(bs.CellVoltage) > 0 {
+		var sum float32
+		pa.MinCellVoltage = float32(math.MaxFloat32)
+		pa.MaxCellVoltage = -float32(math.MaxFloat32)
+		for i, v := range bs.CellVoltage {
+			sum += v
+			if v < pa.MinCellVoltage {
+				pa.MinCellVoltage, pa.MinCellIndex = v, i
+			}
+			if v > pa.MaxCellVoltage {
+				pa.MaxCellVoltage, pa.MaxCellIndex = v, i
+			}
+		}
+		pa.MeanCellVoltage = sum / float32(len(bs.CellVoltage))
+		pa.CellImbalance = pa.MaxCellVoltage - pa.MinCellVoltage
+	}
+
+	if len(bs.Temperature) > 0 {
+		pa.MinTemperature = bs.Temperature[0]
+		pa.MaxTemperature = bs.Temperature[0]
+		for _, t := range bs.Temperature[1:] {
+			pa.MinTemperature = min(pa.MinTemperature, t)
+			pa.MaxTemperature = max(pa.MaxTemperature, t)
+		}
+		pa.TemperatureSpread = pa.MaxTemperature - pa.MinTemperature
+	}
+
+	return pa
+}
+
+// GroupAnalytics aggregates the analytics of all packs of a battery group.
+// Packs count from 1, as in the protocol.
+type GroupAnalytics struct {
+	Packs []PackAnalytics
+	// State of charge of the group in percent, weighted by pack capacity
+	SOC               float32
+	RemainingCapacity float32
+	TotalCapacity     float32
+	// Mean of the pack voltages
+	Voltage         float32
+	Current         float32
+	Power           float32
+	MinCellVoltage  float32
+	MinCellPack     int
+	MinCellIndex    int
+	MaxCellVoltage  float32
+	MaxCellPack     int
+	MaxCellIndex    int
+	MeanCellVoltage float32
+	// Difference between the highest and lowest cell voltage of all packs
+	CellImbalance     float32
+	MinTemperature    float32
+	MaxTemperature    float32
+	TemperatureSpread float32
+}
+
+func (bgs *BatteryGroupStatus) Analytics() GroupAnalytics {
+	ga := GroupAnalytics{}
+	if len(bgs.Status) == 0 {
+		return ga
+	}
+
+	var voltage, cellSum float32
+	cellCount := 0
+	tempSeen := false
+	for i := range bgs.Status {
+		bs := &bgs.Status[i]
+		pa := bs.Analytics()
+		ga.Packs = append(ga.Packs, pa)
+
+		ga.RemainingCapacity += bs.RemainingCapacity
+		ga.TotalCapacity += bs.TotalCapacity
+		voltage += bs.TotalVoltage
+		ga.Current += bs.Current
+		ga.Power += pa.Power
+
+		if len(bs.CellVoltage) > 0 {
+			if ga.MinCellPack == 0 || pa.MinCellVoltage < ga.MinCellVoltage {
+				ga.MinCellVoltage, ga.MinCellPack, ga.MinCellIndex = pa.MinCellVoltage, i+1, pa.MinCellIndex
+			}
+			if ga.MaxCellPack == 0 || pa.MaxCellVoltage > ga.MaxCellVoltage {
+				ga.MaxCellVoltage, ga.MaxCellPack, ga.MaxCellIndex = pa.MaxCellVoltage, i+1, pa.MaxCellIndex
+			}
+			cellSum += pa.MeanCellVoltage * float32(len(bs.CellVoltage))
+			cellCount += len(bs.CellVoltage)
+		}
+
+		if len(bs.Temperature) > 0 {
+			if !tempSeen || pa.MinTemperature < ga.MinTemperature {
+				ga.MinTemperature = pa.MinTemperature
+			}
+			if !tempSeen || pa.MaxTemperature > ga.MaxTemperature {
+				ga.MaxTemperature = pa.MaxTemperature
+			}
+			tempSeen = true
+		}
+	}
+
+	ga.SOC = soc(ga.RemainingCapacity, ga.TotalCapacity)
+	ga.Voltage = voltage / float32(len(bgs.Status))
+	if cellCount > 0 {
+		ga.MeanCellVoltage = cellSum / float32(cellCount)
+		ga.CellImbalance = ga.MaxCellVoltage - ga.MinCellVoltage
+	}
+	ga.TemperatureSpread = ga.MaxTemperature - ga.MinTemperature
+
+	return ga
+}
+
+// Returns the state of charge in percent, 0 if the capacity is unknown.
+func soc(remaining float32, total float32) float32 {
+	if total <= 0 {
+		return 0
+	}
+	return remaining / total * 100
+}
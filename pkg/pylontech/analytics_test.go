@@ -0,0 +1,118 @@
+package pylontech
+
+import (
+	"math"
+	"testing"
+)
+
+func approx(a float32, b float32) bool {
+	return math.Abs(float64(a-b)) < 0.001
+}
+
+func TestBatteryStatusAnalytics(t *testing.T) {
+	bs := BatteryStatus{
+		CellCount:         4,
+		CellVoltage:       []float32{3.301, 3.295, 3.310, 3.302},
+		TempCount:         3,
+		Temperature:       []float32{21.5, 24.0, 22.1},
+		Current:           -10,
+		TotalVoltage:      52,
+		RemainingCapacity: 37,
+		TotalCapacity:     74,
+	}
+
+	got := bs.Analytics()
+
+	if !approx(got.SOC, 50) {
+		t.Errorf("Analytics() SOC = %v, want 50", got.SOC)
+	}
+	if !approx(got.MinCellVoltage, 3.295) || got.MinCellIndex != 1 {
+		t.Errorf("Analytics() min cell = %v at %d, want 3.295 at 1", got.MinCellVoltage, got.MinCellIndex)
+	}
+	if !approx(got.MaxCellVoltage, 3.310) || got.MaxCellIndex != 2 {
+		t.Errorf("Analytics() max cell = %v at %d, want 3.310 at 2", got.MaxCellVoltage, got.MaxCellIndex)
+	}
+	if !approx(got.MeanCellVoltage, 3.302) {
+		t.Errorf("Analytics() mean cell = %v, want 3.302", got.MeanCellVoltage)
+	}
+	if !approx(got.CellImbalance, 0.015) {
+		t.Errorf("Analytics() imbalance = %v, want 0.015", got.CellImbalance)
+	}
+	if !approx(got.TemperatureSpread, 2.5) {
+		t.Errorf("Analytics() temperature spread = %v, want 2.5", got.TemperatureSpread)
+	}
+	if !approx(got.Power, -520) {
+		t.Errorf("Analytics() power = %v, want -520", got.Power)
+	}
+}
+
+func TestBatteryStatusAnalyticsEmpty(t *testing.T) {
+	got := (&BatteryStatus{}).Analytics()
+	if got != (PackAnalytics{}) {
+		t.Errorf("Analytics() = %+v, want zero", got)
+	}
+}
+
+func TestBatteryGroupStatusAnalytics(t *testing.T) {
+	bgs := BatteryGroupStatus{
+		Count: 2,
+		Status: []BatteryStatus{
+			{
+				CellVoltage:       []float32{3.30, 3.31},
+				Temperature:       []float32{20, 22},
+				Current:           5,
+				TotalVoltage:      50,
+				RemainingCapacity: 50,
+				TotalCapacity:     50,
+			},
+			{
+				CellVoltage:       []float32{3.28, 3.32},
+				Temperature:       []float32{25, 23},
+				Current:           3,
+				TotalVoltage:      52,
+				RemainingCapacity: 0,
+				TotalCapacity:     50,
+			},
+		},
+	}
+
+	got := bgs.Analytics()
+
+	if len(got.Packs) != 2 {
+		t.Fatalf("Analytics() packs = %d, want 2", len(got.Packs))
+	}
+	if !approx(got.SOC, 50) {
+		t.Errorf("Analytics() SOC = %v, want 50", got.SOC)
+	}
+	if !approx(got.Voltage, 51) || !approx(got.Current, 8) || !approx(got.Power, 406) {
+		t.Errorf("Analytics() voltage, current, power = %v, %v, %v, want 51, 8, 406", got.Voltage, got.Current, got.Power)
+	}
+	if !approx(got.MinCellVoltage, 3.28) || got.MinCellPack != 2 || got.MinCellIndex != 0 {
+		t.Errorf("Analytics() min cell = %v in pack %d at %d, want 3.28 in pack 2 at 0", got.MinCellVoltage, got.MinCellPack, got.MinCellIndex)
+	}
+	if !approx(got.MaxCellVoltage, 3.32) || got.MaxCellPack != 2 || got.MaxCellIndex != 1 {
+		t.Errorf("Analytics() max cell = %v in pack %d at %d, want 3.32 in pack 2 at 1", got.MaxCellVoltage, got.MaxCellPack, got.MaxCellIndex)
+	}
+	if !approx(got.MeanCellVoltage, 3.3025) || !approx(got.CellImbalance, 0.04) {
+		t.Errorf("Analytics() mean cell, imbalance = %v, %v, want 3.3025, 0.04", got.MeanCellVoltage, got.CellImbalance)
+	}
+	if !approx(got.MinTemperature, 20) || !approx(got.MaxTemperature, 25) || !approx(got.TemperatureSpread, 5) {
+		t.Errorf("Analytics() temperatures = %v, %v, %v, want 20, 25, 5", got.MinTemperature, got.MaxTemperature, got.TemperatureSpread)
+	}
+}
+
+func TestBatteryGroupStatusAnalyticsNoSensors(t *testing.T) {
+	// The first pack reports no temperatures, which must not count as 0°C
+	bgs := BatteryGroupStatus{
+		Count: 2,
+		Status: []BatteryStatus{
+			{CellVoltage: []float32{3.30}},
+			{CellVoltage: []float32{3.31}, Temperature: []float32{25, 23}},
+		},
+	}
+
+	got := bgs.Analytics()
+	if !approx(got.MinTemperature, 23) || !approx(got.MaxTemperature, 25) || !approx(got.TemperatureSpread, 2) {
+		t.Errorf("Analytics() temperatures = %v, %v, %v, want 23, 25, 2", got.MinTemperature, got.MaxTemperature, got.TemperatureSpread)
+	}
+}
@@ -0,0 +1,143 @@
+package can
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Frames sent by the master pack every second, at 500 kbit/s. Values are
+// little endian.
+const (
+	chargeLimitsID = 0x351
+	socID          = 0x355
+	measurementsID = 0x356
+	alarmsID       = 0x359
+	requestFlagsID = 0x35C
+	manufacturerID = 0x35E
+)
+
+// The frame is shorter than its contents require
+var ErrShortFrame = errors.New("frame too short")
+
+// Frame is a single CAN frame with a standard (11 bit) or extended (29 bit)
+// identifier.
+type Frame struct {
+	ID   uint32
+	Data []byte
+}
+
+// Protection and alarm flags of frame 0x359, protections are active when
+// the battery stopped charging or discharging.
+type Flags struct {
+	OverVoltage          bool
+	UnderVoltage         bool
+	OverTemperature      bool
+	UnderTemperature     bool
+	DischargeOverCurrent bool
+	ChargeOverCurrent    bool
+	// A system error for protections, an internal communication failure
+	// for alarms
+	SystemError bool
+}
+
+// Status is the state of the battery group as decoded from the frames
+// received so far. Voltages are in V, currents in A and temperatures in °C,
+// both current limits are positive.
+type Status struct {
+	ChargeVoltageLimit    float32
+	ChargeCurrentLimit    float32
+	DischargeCurrentLimit float32
+	DischargeVoltageLimit float32
+	SOC                   int
+	SOH                   int
+	Voltage               float32
+	Current               float32
+	Temperature           float32
+	Protection            Flags
+	Alarm                 Flags
+	ModuleCount           int
+	ChargeEnabled         bool
+	DischargeEnabled      bool
+	// Charge immediately, requested at a state of charge of 5-9%
+	ForceCharge1 bool
+	// Charge immediately, requested at a state of charge of 9-13%
+	ForceCharge2      bool
+	FullChargeRequest bool
+	Manufacturer      string
+	// Time the last known frame was decoded
+	Updated time.Time
+}
+
+// Decodes a frame into s. Returns false for frames that are not part of the
+// protocol, which are left for other devices on the bus.
+func (s *Status) Decode(f Frame, t time.Time) (bool, error) {
+	d := f.Data
+	switch f.ID {
+	case chargeLimitsID:
+		if len(d) < 6 {
+			return true, shortFrame(f)
+		}
+		s.ChargeVoltageLimit = float32(binary.LittleEndian.Uint16(d[0:2])) / 10.0
+		s.ChargeCurrentLimit = float32(int16(binary.LittleEndian.Uint16(d[2:4]))) / 10.0
+		s.DischargeCurrentLimit = float32(int16(binary.LittleEndian.Uint16(d[4:6]))) / 10.0
+		// Not sent by all firmware versions
+		if len(d) >= 8 {
+			s.DischargeVoltageLimit = float32(binary.LittleEndian.Uint16(d[6:8])) / 10.0
+		}
+	case socID:
+		if len(d) < 4 {
+			return true, shortFrame(f)
+		}
+		s.SOC = int(binary.LittleEndian.Uint16(d[0:2]))
+		s.SOH = int(binary.LittleEndian.Uint16(d[2:4]))
+	case measurementsID:
+		if len(d) < 6 {
+			return true, shortFrame(f)
+		}
+		s.Voltage = float32(int16(binary.LittleEndian.Uint16(d[0:2]))) / 100.0
+		s.Current = float32(int16(binary.LittleEndian.Uint16(d[2:4]))) / 10.0
+		s.Temperature = float32(int16(binary.LittleEndian.Uint16(d[4:6]))) / 10.0
+	case alarmsID:
+		if len(d) < 5 {
+			return true, shortFrame(f)
+		}
+		s.Protection = decodeFlags(d[0], d[1])
+		s.Alarm = decodeFlags(d[2], d[3])
+		s.ModuleCount = int(d[4])
+	case requestFlagsID:
+		if len(d) < 1 {
+			return true, shortFrame(f)
+		}
+		s.ChargeEnabled = d[0]&0x80 == 0x80
+		s.DischargeEnabled = d[0]&0x40 == 0x40
+		s.ForceCharge1 = d[0]&0x20 == 0x20
+		s.ForceCharge2 = d[0]&0x10 == 0x10
+		s.FullChargeRequest = d[0]&0x08 == 0x08
+	case manufacturerID:
+		s.Manufacturer = strings.TrimRight(string(d), " \x00")
+	default:
+		return false, nil
+	}
+
+	s.Updated = t
+	return true, nil
+}
+
+func decodeFlags(b0 byte, b1 byte) Flags {
+	return Flags{
+		OverVoltage:          b0&0x02 == 0x02,
+		UnderVoltage:         b0&0x04 == 0x04,
+		OverTemperature:      b0&0x08 == 0x08,
+		UnderTemperature:     b0&0x10 == 0x10,
+		DischargeOverCurrent: b0&0x80 == 0x80,
+		ChargeOverCurrent:    b1&0x01 == 0x01,
+		SystemError:          b1&0x08 == 0x08,
+	}
+}
+
+func shortFrame(f Frame) error {
+	return fmt.Errorf("%w: %03X with %d bytes", ErrShortFrame, f.ID, len(f.Data))
+}
@@ -0,0 +1,98 @@
+package can
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Frames captured from a US3000C group of two packs, charging
+var capturedFrames = []Frame{
+	{ID: 0x351, Data: []byte{0x14, 0x02, 0x4A, 0x01, 0x4A, 0x01, 0xD2, 0x01}},
+	{ID: 0x355, Data: []byte{0x3C, 0x00, 0x64, 0x00}},
+	{ID: 0x356, Data: []byte{0x7E, 0x13, 0x7B, 0x00, 0xE6, 0x00}},
+	{ID: 0x359, Data: []byte{0x00, 0x00, 0x08, 0x00, 0x02, 0x50, 0x4E}},
+	{ID: 0x35C, Data: []byte{0xC0, 0x00}},
+	{ID: 0x35E, Data: []byte("PYLON   ")},
+}
+
+func TestStatus_Decode(t *testing.T) {
+	now := time.Now()
+	s := Status{}
+	for _, f := range capturedFrames {
+		known, err := s.Decode(f, now)
+		if !known || err != nil {
+			t.Errorf("Decode(%03X) got = %v, %v", f.ID, known, err)
+		}
+	}
+
+	want := Status{
+		ChargeVoltageLimit:    53.2,
+		ChargeCurrentLimit:    33,
+		DischargeCurrentLimit: 33,
+		DischargeVoltageLimit: 46.6,
+		SOC:                   60,
+		SOH:                   100,
+		Voltage:               49.9,
+		Current:               12.3,
+		Temperature:           23,
+		Alarm:                 Flags{OverTemperature: true},
+		ModuleCount:           2,
+		ChargeEnabled:         true,
+		DischargeEnabled:      true,
+		Manufacturer:          "PYLON",
+		Updated:               now,
+	}
+	if s != want {
+		t.Errorf("Decode() got = %+v, want %+v", s, want)
+	}
+
+	known, err := s.Decode(Frame{ID: 0x305, Data: []byte{0}}, now)
+	if known || err != nil {
+		t.Errorf("Decode(305) got = %v, %v, want unknown frame", known, err)
+	}
+	_, err = s.Decode(Frame{ID: 0x356, Data: []byte{0x7E, 0x13}}, now)
+	if !errors.Is(err, ErrShortFrame) {
+		t.Errorf("Decode() error = %v, want %v", err, ErrShortFrame)
+	}
+}
+
+func TestDecodeFlags(t *testing.T) {
+	got := decodeFlags(0x9E, 0x09)
+	want := Flags{true, true, true, true, true, true, true}
+	if got != want {
+		t.Errorf("decodeFlags() got = %+v, want %+v", got, want)
+	}
+}
+
+type frameChannel chan Frame
+
+func (fc frameChannel) ReadFrame() (Frame, error) {
+	f, ok := <-fc
+	if !ok {
+		return Frame{}, io.EOF
+	}
+	return f, nil
+}
+
+func TestListener(t *testing.T) {
+	fc := make(frameChannel, len(capturedFrames))
+	for _, f := range capturedFrames {
+		fc <- f
+	}
+	close(fc)
+
+	l := NewListener(fc)
+	if !l.Status().Updated.IsZero() {
+		t.Error("Status() updated before any frame")
+	}
+	err := l.Run(context.Background())
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Run() error = %v, want %v", err, io.EOF)
+	}
+	if s := l.Status(); s.SOC != 60 || s.Manufacturer != "PYLON" || s.Updated.IsZero() {
+		t.Errorf("Status() got = %+v", s)
+	}
+}
@@ -0,0 +1,49 @@
+package can
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type FrameReader interface {
+	ReadFrame() (Frame, error)
+}
+
+// Listener passively decodes the frames sent by the battery, it never
+// writes to the bus.
+type Listener struct {
+	reader FrameReader
+	mu     sync.Mutex
+	status Status
+}
+
+func NewListener(r FrameReader) *Listener {
+	return &Listener{reader: r}
+}
+
+// Reads and decodes frames until ctx is done or reading fails. Frames that
+// cannot be decoded are skipped.
+func (l *Listener) Run(ctx context.Context) error {
+	for {
+		f, err := l.reader.ReadFrame()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		l.mu.Lock()
+		l.status.Decode(f, time.Now())
+		l.mu.Unlock()
+	}
+}
+
+// Returns the status decoded so far, Updated is zero until a frame of the
+// battery has been received.
+func (l *Listener) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
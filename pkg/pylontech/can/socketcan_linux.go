@@ -0,0 +1,93 @@
+//go:build linux
+
+package can
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Size of struct can_frame
+const canFrameLen = 16
+
+// Socket is a raw SocketCAN socket bound to an interface, e.g. can0 or a
+// vcan interface for testing.
+type Socket struct {
+	file *os.File
+}
+
+func OpenSocket(iface string) (*Socket, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW, unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CAN socket: %w", err)
+	}
+	err = unix.Bind(fd, &unix.SockaddrCAN{Ifindex: ifi.Index})
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind CAN socket to %s: %w", iface, err)
+	}
+	// Non-blocking, so that Close interrupts a pending read
+	err = unix.SetNonblock(fd, true)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &Socket{file: os.NewFile(uintptr(fd), iface)}, nil
+}
+
+// Returns the next data frame, error and remote frames are skipped.
+func (s *Socket) ReadFrame() (Frame, error) {
+	buf := make([]byte, canFrameLen)
+	for {
+		n, err := s.file.Read(buf)
+		if err != nil {
+			return Frame{}, err
+		}
+		if n < canFrameLen {
+			continue
+		}
+
+		id := binary.NativeEndian.Uint32(buf[0:4])
+		if id&(unix.CAN_ERR_FLAG|unix.CAN_RTR_FLAG) != 0 {
+			continue
+		}
+		if id&unix.CAN_EFF_FLAG != 0 {
+			id &= unix.CAN_EFF_MASK
+		} else {
+			id &= unix.CAN_SFF_MASK
+		}
+		dlc := min(int(buf[4]), 8)
+		return Frame{ID: id, Data: append([]byte(nil), buf[8:8+dlc]...)}, nil
+	}
+}
+
+func (s *Socket) WriteFrame(f Frame) error {
+	if len(f.Data) > 8 {
+		return fmt.Errorf("frame %03X with %d bytes, at most 8 allowed", f.ID, len(f.Data))
+	}
+
+	id := f.ID
+	if id > unix.CAN_SFF_MASK {
+		id |= unix.CAN_EFF_FLAG
+	}
+	buf := make([]byte, canFrameLen)
+	binary.NativeEndian.PutUint32(buf[0:4], id)
+	buf[4] = byte(len(f.Data))
+	copy(buf[8:], f.Data)
+	_, err := s.file.Write(buf)
+	return err
+}
+
+func (s *Socket) Close() error {
+	return s.file.Close()
+}
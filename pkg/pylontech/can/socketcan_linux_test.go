@@ -0,0 +1,46 @@
+package can
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Requires a vcan interface, set up with
+//
+//	ip link add dev vcan0 type vcan && ip link set up vcan0
+func TestSocketVCAN(t *testing.T) {
+	listen, err := OpenSocket("vcan0")
+	if err != nil {
+		t.Skip("no vcan0 interface: ", err)
+	}
+	send, err := OpenSocket("vcan0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer send.Close()
+
+	l := NewListener(listen)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+
+	for _, f := range capturedFrames {
+		err = send.WriteFrame(f)
+		if err != nil {
+			t.Fatalf("WriteFrame() error = %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for l.Status().Manufacturer == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := l.Status(); s.SOC != 60 || s.ModuleCount != 2 || s.Manufacturer != "PYLON" {
+		t.Errorf("Status() got = %+v", s)
+	}
+
+	cancel()
+	listen.Close()
+	<-done
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package can
+
+import "errors"
+
+type Socket struct{}
+
+func OpenSocket(iface string) (*Socket, error) {
+	return nil, errors.New("SocketCAN is only supported on linux")
+}
+
+func (s *Socket) ReadFrame() (Frame, error) {
+	return Frame{}, errors.New("SocketCAN is only supported on linux")
+}
+
+func (s *Socket) WriteFrame(f Frame) error {
+	return errors.New("SocketCAN is only supported on linux")
+}
+
+func (s *Socket) Close() error {
+	return nil
+}
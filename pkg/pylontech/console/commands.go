@@ -0,0 +1,309 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// PowerStatus is a row of the pwr command, one per pack of the group.
+// Voltages are in V, currents in A and temperatures in °C.
+type PowerStatus struct {
+	Power                   int
+	Present                 bool
+	Voltage                 float32
+	Current                 float32
+	Temperature             float32
+	TemperatureLow          float32
+	TemperatureHigh         float32
+	CellVoltageLow          float32
+	CellVoltageHigh         float32
+	BaseState               string
+	VoltageState            string
+	CurrentState            string
+	TemperatureState        string
+	SOC                     int
+	Time                    time.Time
+	BalanceVoltageState     string
+	BalanceTemperatureState string
+	MOSTemperature          float32
+	MOSTemperatureState     string
+}
+
+func GetPower(c connector.Connector) ([]PowerStatus, error) {
+	return GetPowerContext(context.Background(), c)
+}
+
+func GetPowerContext(ctx context.Context, c connector.Connector) ([]PowerStatus, error) {
+	lines, err := CommandContext(ctx, c, "pwr")
+	if err != nil {
+		return nil, err
+	}
+	return parsePower(lines)
+}
+
+func parsePower(lines []string) ([]PowerStatus, error) {
+	rows, err := parseTable(lines, "Power")
+	if err != nil {
+		return nil, err
+	}
+
+	var status []PowerStatus
+	for _, row := range rows {
+		ps := PowerStatus{
+			Power:                   intValue(row["Power"]),
+			Present:                 row["Base.St"] != "" && row["Base.St"] != "Absent",
+			Voltage:                 milli(row["Volt"]),
+			Current:                 milli(row["Curr"]),
+			Temperature:             milli(row["Tempr"]),
+			TemperatureLow:          milli(row["Tlow"]),
+			TemperatureHigh:         milli(row["Thigh"]),
+			CellVoltageLow:          milli(row["Vlow"]),
+			CellVoltageHigh:         milli(row["Vhigh"]),
+			BaseState:               row["Base.St"],
+			VoltageState:            state(row["Volt.St"]),
+			CurrentState:            state(row["Curr.St"]),
+			TemperatureState:        state(row["Temp.St"]),
+			SOC:                     intValue(row["Coulomb"]),
+			BalanceVoltageState:     state(row["B.V.St"]),
+			BalanceTemperatureState: state(row["B.T.St"]),
+			MOSTemperature:          milli(row["MosTempr"]),
+			MOSTemperatureState:     state(row["M.T.St"]),
+		}
+		if t, err := time.Parse("2006-01-02T15:04:05", row["Time"]); err == nil {
+			ps.Time = t
+		}
+		status = append(status, ps)
+	}
+	return status, nil
+}
+
+// CellStatus is a row of the bat command, one per cell of a pack. Voltages
+// are in V, currents in A, temperatures in °C and the coulomb counter in Ah.
+type CellStatus struct {
+	Cell             int
+	Voltage          float32
+	Current          float32
+	Temperature      float32
+	BaseState        string
+	VoltageState     string
+	CurrentState     string
+	TemperatureState string
+	SOC              int
+	Coulomb          float32
+	Balancing        bool
+}
+
+// Returns the cells of pack number pack, counting from 1.
+func GetBattery(c connector.Connector, pack int) ([]CellStatus, error) {
+	return GetBatteryContext(context.Background(), c, pack)
+}
+
+func GetBatteryContext(ctx context.Context, c connector.Connector, pack int) ([]CellStatus, error) {
+	lines, err := CommandContext(ctx, c, fmt.Sprintf("bat %d", pack))
+	if err != nil {
+		return nil, err
+	}
+	return parseBattery(lines)
+}
+
+func parseBattery(lines []string) ([]CellStatus, error) {
+	rows, err := parseTable(lines, "Battery")
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []CellStatus
+	for _, row := range rows {
+		cells = append(cells, CellStatus{
+			Cell:             intValue(row["Battery"]),
+			Voltage:          milli(row["Volt"]),
+			Current:          milli(row["Curr"]),
+			Temperature:      milli(row["Tempr"]),
+			BaseState:        row["Base.St"],
+			VoltageState:     state(row["Volt.St"]),
+			CurrentState:     state(row["Curr.St"]),
+			TemperatureState: state(row["Temp.St"]),
+			SOC:              intValue(row["SOC"]),
+			Coulomb:          milli(row["Coulomb"]),
+			Balancing:        row["BAL"] == "Y",
+		})
+	}
+	return cells, nil
+}
+
+// CellSOH is a row of the soh command, the state of health of a cell.
+type CellSOH struct {
+	Cell    int
+	Voltage float32
+	Count   int
+	Status  string
+}
+
+// Returns the state of health of the cells of pack number pack, counting
+// from 1.
+func GetSOH(c connector.Connector, pack int) ([]CellSOH, error) {
+	return GetSOHContext(context.Background(), c, pack)
+}
+
+func GetSOHContext(ctx context.Context, c connector.Connector, pack int) ([]CellSOH, error) {
+	lines, err := CommandContext(ctx, c, fmt.Sprintf("soh %d", pack))
+	if err != nil {
+		return nil, err
+	}
+	return parseSOH(lines)
+}
+
+func parseSOH(lines []string) ([]CellSOH, error) {
+	rows, err := parseTable(lines, "Battery")
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []CellSOH
+	for _, row := range rows {
+		cells = append(cells, CellSOH{
+			Cell:    intValue(row["Battery"]),
+			Voltage: milli(row["Voltage"]),
+			Count:   intValue(row["SOHCount"]),
+			Status:  row["SOHStatus"],
+		})
+	}
+	return cells, nil
+}
+
+// Statistics are the lifetime counters of the stat command. Fields holds
+// all reported counters, as they differ between firmware versions.
+type Statistics struct {
+	Address        int
+	ChargeCount    int
+	DischargeCount int
+	CycleCount     int
+	SOHCount       int
+	PowerPercent   int
+	Fields         map[string]string
+}
+
+// Returns the statistics of pack number pack, or of the pack connected to
+// the console if pack is 0.
+func GetStatistics(c connector.Connector, pack int) (*Statistics, error) {
+	return GetStatisticsContext(context.Background(), c, pack)
+}
+
+func GetStatisticsContext(ctx context.Context, c connector.Connector, pack int) (*Statistics, error) {
+	lines, err := CommandContext(ctx, c, withPack("stat", pack))
+	if err != nil {
+		return nil, err
+	}
+	return parseStatistics(lines)
+}
+
+func parseStatistics(lines []string) (*Statistics, error) {
+	fields := parseFields(lines)
+	if _, ok := fields["Device address"]; !ok {
+		return nil, fmt.Errorf("%w: no device address in statistics", ErrInvalidOutput)
+	}
+
+	return &Statistics{
+		Address:        intValue(fields["Device address"]),
+		ChargeCount:    intValue(fields["CHG Cnt."]),
+		DischargeCount: intValue(fields["DSG Cnt."]),
+		CycleCount:     intValue(fields["Cycle Times"]),
+		SOHCount:       intValue(fields["SOH Times"]),
+		PowerPercent:   intValue(fields["Pwr Percent"]),
+		Fields:         fields,
+	}, nil
+}
+
+// Info is the output of the info command, currents are in A.
+type Info struct {
+	Address             int
+	Manufacturer        string
+	DeviceName          string
+	BoardVersion        string
+	MainSoftVersion     string
+	SoftVersion         string
+	BootVersion         string
+	CommVersion         string
+	ReleaseDate         string
+	Barcode             string
+	Specification       string
+	CellCount           int
+	MaxDischargeCurrent float32
+	MaxChargeCurrent    float32
+}
+
+// Returns the info of pack number pack, or of the pack connected to the
+// console if pack is 0.
+func GetInfo(c connector.Connector, pack int) (*Info, error) {
+	return GetInfoContext(context.Background(), c, pack)
+}
+
+func GetInfoContext(ctx context.Context, c connector.Connector, pack int) (*Info, error) {
+	lines, err := CommandContext(ctx, c, withPack("info", pack))
+	if err != nil {
+		return nil, err
+	}
+	return parseInfo(lines)
+}
+
+func parseInfo(lines []string) (*Info, error) {
+	fields := parseFields(lines)
+	if _, ok := fields["Device address"]; !ok {
+		return nil, fmt.Errorf("%w: no device address in info", ErrInvalidOutput)
+	}
+
+	return &Info{
+		Address:             intValue(fields["Device address"]),
+		Manufacturer:        fields["Manufacturer"],
+		DeviceName:          fields["Device name"],
+		BoardVersion:        fields["Board version"],
+		MainSoftVersion:     fields["Main Soft version"],
+		SoftVersion:         fields["Soft version"],
+		BootVersion:         fields["Boot version"],
+		CommVersion:         fields["Comm version"],
+		ReleaseDate:         fields["Release Date"],
+		Barcode:             fields["Barcode"],
+		Specification:       fields["Specification"],
+		CellCount:           intValue(fields["Cell Number"]),
+		MaxDischargeCurrent: milli(fields["Max Dischg Curr"]),
+		MaxChargeCurrent:    milli(fields["Max Charge Curr"]),
+	}, nil
+}
+
+func withPack(command string, pack int) string {
+	if pack == 0 {
+		return command
+	}
+	return fmt.Sprintf("%s %d", command, pack)
+}
+
+// Returns the leading integer of a value like 60% or 44400mAH, 0 for - and
+// other missing values.
+func intValue(value string) int {
+	end := 0
+	for end < len(value) && (value[end] >= '0' && value[end] <= '9' || end == 0 && value[end] == '-') {
+		end++
+	}
+	i, err := strconv.Atoi(value[:end])
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+// Returns a value in mV, mA, m°C or mAh in units.
+func milli(value string) float32 {
+	return float32(intValue(value)) / 1000.0
+}
+
+// Returns the state, empty if the console shows - for it.
+func state(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
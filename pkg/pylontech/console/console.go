@@ -0,0 +1,153 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// The console of a pack, usually on its RJ45 or RJ11 "Console" port at
+// 115200 baud, answers text commands like
+//
+//	pwr
+//	@
+//
+//	Power Volt   Curr   Tempr ...
+//	1     49898  -1195  23000 ...
+//	Command completed successfully
+//	$$
+//
+//	pylon>
+//
+// The output starts after the @ line and ends with the $$ line.
+
+var (
+	// The console did not report the command as completed successfully
+	ErrCommandFailed = errors.New("command failed")
+	// The output does not contain the expected table or fields
+	ErrInvalidOutput = errors.New("invalid output")
+)
+
+const (
+	outputStart = "@"
+	outputEnd   = "$$"
+	completed   = "Command completed successfully"
+)
+
+// Sends a command and returns the lines of its output, without the trailing
+// completion message.
+func Command(c connector.Connector, command string) ([]string, error) {
+	return CommandContext(context.Background(), c, command)
+}
+
+func CommandContext(ctx context.Context, c connector.Connector, command string) ([]string, error) {
+	err := connector.WriteContext(ctx, c, []byte(command+"\r"))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	started := false
+	for {
+		read, err := connector.ReadContext(ctx, c, '\n')
+		if err != nil {
+			return nil, err
+		}
+		// Lines end with CR LF, the prompt of the previous command and the
+		// echo of the command are skipped until the start marker
+		line := strings.TrimRight(string(read), "\r\n")
+		line = strings.TrimLeft(line, "\r")
+
+		switch {
+		case !started:
+			started = strings.TrimSpace(line) == outputStart
+		case strings.TrimSpace(line) == outputEnd:
+			return completedOutput(command, lines)
+		default:
+			lines = append(lines, line)
+		}
+	}
+}
+
+func completedOutput(command string, lines []string) ([]string, error) {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if line != completed {
+			return nil, fmt.Errorf("%w: %s: %s", ErrCommandFailed, command, line)
+		}
+		return lines[:i], nil
+	}
+	return nil, fmt.Errorf("%w: %s: no output", ErrCommandFailed, command)
+}
+
+// Multi-word column names of the bat command, replaced by the abbreviations
+// used by pwr
+var columnNames = strings.NewReplacer(
+	"Base State", "Base.St",
+	"Volt. State", "Volt.St",
+	"Curr. State", "Curr.St",
+	"Temp. State", "Temp.St",
+)
+
+var (
+	dateTime  = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}) (\d{2}:\d{2}:\d{2})`)
+	valueUnit = regexp.MustCompile(`(\d) +(mAH|mAh|mV|mA)\b`)
+)
+
+// Returns the rows of the table starting with a header line whose first
+// column is first, as maps from column name to value. Dates with a time and
+// values followed by a unit are kept as a single value.
+func parseTable(lines []string, first string) ([]map[string]string, error) {
+	header := -1
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == first {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, fmt.Errorf("%w: no %s table", ErrInvalidOutput, first)
+	}
+
+	columns := strings.Fields(columnNames.Replace(lines[header]))
+	var rows []map[string]string
+	for _, line := range lines[header+1:] {
+		line = dateTime.ReplaceAllString(line, "${1}T${2}")
+		line = valueUnit.ReplaceAllString(line, "${1}${2}")
+		values := strings.Fields(line)
+		if len(values) == 0 {
+			continue
+		}
+
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			if i < len(values) {
+				row[column] = values[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Returns the "key : value" lines of the output as a map, with runs of spaces
+// in keys collapsed.
+func parseFields(lines []string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields[strings.Join(strings.Fields(key), " ")] = strings.TrimSpace(value)
+	}
+	return fields
+}
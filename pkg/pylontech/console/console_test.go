@@ -0,0 +1,163 @@
+package console
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// Answers commands with the captured output in testdata.
+func capturedConsole(t *testing.T) connector.Connector {
+	t.Helper()
+	outputs := map[string]string{
+		"pwr\r":   "testdata/pwr.txt",
+		"bat 1\r": "testdata/bat.txt",
+		"soh 1\r": "testdata/soh.txt",
+		"info\r":  "testdata/info.txt",
+		"stat\r":  "testdata/stat.txt",
+	}
+	return connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		path, ok := outputs[string(request)]
+		if !ok {
+			return []byte("\r\npylon>" + string(request) + "\n@\r\nInvalid command or fail to excute.\r\n$$\r\n\r\npylon>")
+		}
+		output, err := os.ReadFile(path)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return output
+	}))
+}
+
+func TestGetPower(t *testing.T) {
+	got, err := GetPower(capturedConsole(t))
+	if err != nil {
+		t.Fatalf("GetPower() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("GetPower() got %d packs, want 3", len(got))
+	}
+
+	want := PowerStatus{
+		Power:                   2,
+		Present:                 true,
+		Voltage:                 49.902,
+		Current:                 -1.116,
+		Temperature:             24,
+		TemperatureLow:          22,
+		TemperatureHigh:         23,
+		CellVoltageLow:          3.325,
+		CellVoltageHigh:         3.329,
+		BaseState:               "Dischg",
+		VoltageState:            "Normal",
+		CurrentState:            "Normal",
+		TemperatureState:        "Normal",
+		SOC:                     61,
+		Time:                    time.Date(2021, 1, 15, 16, 14, 53, 0, time.UTC),
+		BalanceVoltageState:     "Normal",
+		BalanceTemperatureState: "Normal",
+		MOSTemperature:          24,
+		MOSTemperatureState:     "Normal",
+	}
+	if got[1] != want {
+		t.Errorf("GetPower() got = %+v, want %+v", got[1], want)
+	}
+	if got[2].Present || got[2].Power != 3 || got[2].VoltageState != "" {
+		t.Errorf("GetPower() absent pack got = %+v", got[2])
+	}
+}
+
+func TestGetBattery(t *testing.T) {
+	got, err := GetBattery(capturedConsole(t), 1)
+	if err != nil {
+		t.Fatalf("GetBattery() error = %v", err)
+	}
+	if len(got) != 15 {
+		t.Fatalf("GetBattery() got %d cells, want 15", len(got))
+	}
+
+	want := CellStatus{
+		Cell:             7,
+		Voltage:          3.327,
+		Current:          -0.597,
+		Temperature:      22,
+		BaseState:        "Dischg",
+		VoltageState:     "Normal",
+		CurrentState:     "Normal",
+		TemperatureState: "Normal",
+		SOC:              60,
+		Coulomb:          44.4,
+		Balancing:        true,
+	}
+	if got[7] != want {
+		t.Errorf("GetBattery() got = %+v, want %+v", got[7], want)
+	}
+	if got[0].Balancing {
+		t.Error("GetBattery() cell 0 balancing, want not balancing")
+	}
+}
+
+func TestGetSOH(t *testing.T) {
+	got, err := GetSOH(capturedConsole(t), 1)
+	if err != nil {
+		t.Fatalf("GetSOH() error = %v", err)
+	}
+	if len(got) != 15 {
+		t.Fatalf("GetSOH() got %d cells, want 15", len(got))
+	}
+	want := CellSOH{Cell: 4, Voltage: 3.327, Count: 2, Status: "Abnormal"}
+	if got[4] != want {
+		t.Errorf("GetSOH() got = %+v, want %+v", got[4], want)
+	}
+}
+
+func TestGetInfo(t *testing.T) {
+	got, err := GetInfo(capturedConsole(t), 0)
+	if err != nil {
+		t.Fatalf("GetInfo() error = %v", err)
+	}
+
+	want := Info{
+		Address:             1,
+		Manufacturer:        "Pylon",
+		DeviceName:          "US3000C",
+		BoardVersion:        "PHANTOMSAV10R03",
+		MainSoftVersion:     "B69.6",
+		SoftVersion:         "V2.6",
+		BootVersion:         "V2.0",
+		CommVersion:         "V2.0",
+		ReleaseDate:         "21-09-26",
+		Barcode:             "PPTAP01234567801",
+		Specification:       "48V/74AH",
+		CellCount:           15,
+		MaxDischargeCurrent: -100,
+		MaxChargeCurrent:    102,
+	}
+	if *got != want {
+		t.Errorf("GetInfo() got = %+v, want %+v", *got, want)
+	}
+}
+
+func TestGetStatistics(t *testing.T) {
+	got, err := GetStatistics(capturedConsole(t), 0)
+	if err != nil {
+		t.Fatalf("GetStatistics() error = %v", err)
+	}
+	if got.Address != 1 || got.ChargeCount != 1263 || got.DischargeCount != 1294 || got.CycleCount != 87 || got.PowerPercent != 60 {
+		t.Errorf("GetStatistics() got = %+v", got)
+	}
+	if got.Fields["Bat UV Times"] != "8" {
+		t.Errorf("GetStatistics() fields got = %v", got.Fields)
+	}
+}
+
+func TestCommandFailed(t *testing.T) {
+	_, err := GetBattery(capturedConsole(t), 9)
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Errorf("GetBattery() error = %v, want %v", err, ErrCommandFailed)
+	}
+}
@@ -0,0 +1,74 @@
+package pylontech
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+var (
+	// The battery does not implement the command
+	ErrNotSupported = errors.New("command not supported")
+	// The frame or length checksum does not match the frame contents
+	ErrChecksum = errors.New("checksum error")
+	// The response is not enclosed in ~ and CR, or is not hex encoded
+	ErrFraming = errors.New("framing error")
+	// The response info is shorter than its contents require
+	ErrShortResponse = errors.New("response too short")
+	// A setting is outside of the limits reported by the battery
+	ErrOutOfRange = errors.New("value out of range")
+	// The confirmation of a turn off does not match the pack
+	ErrNotConfirmed = errors.New("not confirmed")
+	// No response arrived in time, the same error as connector.ErrTimeout
+	ErrTimeout = connector.ErrTimeout
+)
+
+// Return codes in the cid2 field of responses
+const (
+	rtnNormal              = 0x00
+	rtnVersionError        = 0x01
+	rtnChecksumError       = 0x02
+	rtnLengthChecksumError = 0x03
+	rtnCID2Invalid         = 0x04
+	rtnCommandFormatError  = 0x05
+	rtnInvalidData         = 0x06
+	rtnAddressError        = 0x90
+	rtnCommunicationError  = 0x91
+)
+
+var rtnDescriptions = map[byte]string{
+	rtnVersionError:        "version error",
+	rtnChecksumError:       "checksum error",
+	rtnLengthChecksumError: "length checksum error",
+	rtnCID2Invalid:         "invalid CID2",
+	rtnCommandFormatError:  "command format error",
+	rtnInvalidData:         "invalid data",
+	rtnAddressError:        "address error",
+	rtnCommunicationError:  "internal communication error",
+}
+
+// ResponseError is returned when the battery answers with a non-zero return
+// code.
+type ResponseError struct {
+	Code byte
+}
+
+func (e *ResponseError) Error() string {
+	if desc, ok := rtnDescriptions[e.Code]; ok {
+		return fmt.Sprintf("battery returned %s (0x%02X)", desc, e.Code)
+	}
+	return fmt.Sprintf("battery returned unknown code 0x%02X", e.Code)
+}
+
+// Checksum errors reported by the battery match ErrChecksum, an invalid CID2
+// matches ErrNotSupported.
+func (e *ResponseError) Unwrap() error {
+	switch e.Code {
+	case rtnChecksumError, rtnLengthChecksumError:
+		return ErrChecksum
+	case rtnCID2Invalid:
+		return ErrNotSupported
+	}
+	return nil
+}
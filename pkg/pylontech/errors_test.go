@@ -0,0 +1,57 @@
+package pylontech
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     error
+		wantCode byte
+	}{
+		{name: "Return code", response: "~200146020000FDB1\r", want: ErrChecksum, wantCode: rtnChecksumError},
+		{name: "Not supported", response: "~200146040000FDAF\r", want: ErrNotSupported, wantCode: rtnCID2Invalid},
+		{name: "Checksum", response: "~200146000000FDB4\r", want: ErrChecksum},
+		{name: "Framing", response: "200146000000FDB3\r", want: ErrFraming},
+		{name: "Short response", response: "~200146000000FDB3\r", want: ErrShortResponse},
+		{name: "Timeout", want: ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+				if tt.response == "" {
+					return nil
+				}
+				return []byte(tt.response)
+			}))
+
+			_, err := GetBatteryStatus(c)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetBatteryStatus() error = %v, want %v", err, tt.want)
+			}
+			var respErr *ResponseError
+			if errors.As(err, &respErr) != (tt.wantCode != 0) || (respErr != nil && respErr.Code != tt.wantCode) {
+				t.Errorf("GetBatteryStatus() error = %v, want return code %02X", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTurnOffWithoutSerialNumber(t *testing.T) {
+	requests := 0
+	c := connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		requests++
+		return nil
+	}))
+
+	// Refused before anything is sent to the battery
+	err := TurnOff(c, 2, "")
+	if !errors.Is(err, ErrNotConfirmed) || requests != 0 {
+		t.Errorf("TurnOff() error = %v after %d requests, want %v", err, requests, ErrNotConfirmed)
+	}
+}
@@ -0,0 +1,178 @@
+package pylontech
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tmthrgd/go-hex"
+)
+
+// Frame is a single request or response on the RS485 bus, with the info
+// payload decoded from hex. In responses CID2 holds the return code rather
+// than a command.
+type Frame struct {
+	Version byte
+	Address byte
+	CID1    byte
+	CID2    Command
+	Info    []byte
+}
+
+// Returns a request for the battery group at address.
+func NewFrame(address byte, command Command, info []byte) *Frame {
+	return &Frame{
+		Version: defaultVersion,
+		Address: address,
+		CID1:    batteryData,
+		CID2:    command,
+		Info:    info,
+	}
+}
+
+// Encodes the frame as sent on the bus, including the length and frame
+// checksums and the terminating CR.
+func (f *Frame) Encode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	info := hex.EncodeUpperToString(f.Info)
+	length, err := lengthChecksum(len(info))
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte(start)
+	data := fmt.Sprintf("%02X%02X%02X%02X%04X%s", f.Version, f.Address, f.CID1, byte(f.CID2), length, info)
+	buf.WriteString(data)
+	checksum, err := frameChecksum(data)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(fmt.Sprintf("%04X", checksum))
+	buf.WriteByte(end)
+	return buf.Bytes(), nil
+}
+
+func lengthChecksum(len int) (uint16, error) {
+	if len < 0 {
+		return 0, fmt.Errorf("invalid length, must be >= 0")
+	}
+	if len > 0x0FFF {
+		return 0, fmt.Errorf("invalid length, must be <= %d", 0xFFF)
+	}
+
+	if len == 0 {
+		return 0, nil
+	}
+
+	ulen := uint16(len)
+	length := (ulen & 0x000F) + ((ulen >> 4) & 0x000F) + ((ulen >> 8) & 0x000F)
+
+	length = (^(length%0x10)+1)<<12 + ulen
+
+	return length, nil
+}
+
+func frameChecksum(frameData string) (uint16, error) {
+	bs := []byte(strings.ToUpper(frameData))
+	var sum uint16
+	for _, b := range bs {
+		sum += uint16(b)
+	}
+
+	sum = ^uint16(uint32(sum)%0x10000) + 1
+
+	return sum, nil
+}
+
+// Decodes a request or response frame, verifying its framing and both
+// checksums.
+func DecodeFrame(response []byte) (*Frame, error) {
+	respData, err := validateFrame(response)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := hex2Bytes(respData[0:12])
+	if err != nil {
+		return nil, err
+	}
+	f := &Frame{
+		Version: header[0],
+		Address: header[1],
+		CID1:    header[2],
+		CID2:    Command(header[3]),
+	}
+
+	infoLen := binary.BigEndian.Uint16(header[4:6])
+	info := respData[12:]
+
+	lenCheck, err := lengthChecksum(len(info))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFraming, err)
+	}
+	if lenCheck != infoLen {
+		return nil, fmt.Errorf("%w: invalid length, received %v, calculated %v", ErrChecksum, infoLen, lenCheck)
+	}
+	f.Info, err = hex2Bytes(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func hex2Bytes(hexBytes []byte) ([]byte, error) {
+	hexLen := len(hexBytes)
+	if hexLen%2 != 0 {
+		return nil, fmt.Errorf("%w: odd number of hex digits %d", ErrFraming, hexLen)
+	}
+
+	bs := make([]byte, 0, hexLen/2)
+	for i := 0; i < hexLen; i += 2 {
+		b, err := hex2Byte(hexBytes[i : i+2])
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, b)
+	}
+	return bs, nil
+}
+
+func hex2Byte(hexBytes []byte) (byte, error) {
+	parsed, err := strconv.ParseUint(string(hexBytes), 16, 8)
+	if err != nil || len(hexBytes) != 2 {
+		return 0, fmt.Errorf("%w: invalid hex %q", ErrFraming, hexBytes)
+	}
+
+	return byte(parsed), nil
+}
+
+func validateFrame(response []byte) ([]byte, error) {
+	rlen := len(response)
+	if rlen < 18 {
+		return nil, fmt.Errorf("%w: response of %d bytes", ErrFraming, rlen)
+	}
+	if response[0] != start {
+		return nil, fmt.Errorf("%w: invalid response start %v", ErrFraming, response[0])
+	}
+	if response[rlen-1] != end {
+		return nil, fmt.Errorf("%w: invalid response end %v", ErrFraming, response[rlen-1])
+	}
+	checkStart := rlen - 5
+	respData := response[1:checkStart]
+	respCheck := string(response[checkStart : rlen-1])
+	dataSum, err := frameChecksum(string(respData))
+	if err != nil {
+		return nil, err
+	}
+	checkSum, err := strconv.ParseUint(respCheck, 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid checksum %s", ErrFraming, respCheck)
+	}
+	if uint16(checkSum) != dataSum {
+		return nil, fmt.Errorf("%w, received: %v, calculated: %v", ErrChecksum, checkSum, dataSum)
+	}
+
+	return respData, nil
+}
@@ -0,0 +1,21 @@
+package pylontech
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	SetLogger(nil)
+}
+
+// Sets the logger for the frames exchanged with the battery, logged at debug
+// level. Nothing is logged by default, a nil logger discards the logs again.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+	logger.Store(l)
+}
@@ -2,34 +2,53 @@ package pylontech
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
-	"log"
-	"strconv"
+	"math"
 	"strings"
 
-	"github.com/tmthrgd/go-hex"
-
 	"github.com/marevers/energia/pkg/connector"
 )
 
-//go:generate enumer -type=command -json
-type command uint8
+//go:generate enumer -type=Command -json
+type Command uint8
 
 const (
-	getBatteryStatus        command = 0x42
-	getAlarmData                    = 0x44
-	getSystemParameter              = 0x47
-	getProtocolVersion              = 0x4F
-	getManufacturerInfo             = 0x51
-	getChargeManagementInfo         = 0x92
-	getSeriesNumber                 = 0x93
-	setChargeManagementInfo         = 0x94
-	turnOff                         = 0x95
+	CmdGetBatteryStatus        Command = 0x42
+	CmdGetAlarmData            Command = 0x44
+	CmdGetSystemParameter      Command = 0x47
+	CmdGetProtocolVersion      Command = 0x4F
+	CmdGetManufacturerInfo     Command = 0x51
+	CmdGetChargeManagementInfo Command = 0x92
+	CmdGetSeriesNumber         Command = 0x93
+	CmdSetChargeManagementInfo Command = 0x94
+	CmdTurnOff                 Command = 0x95
 )
 
+var commandNames = map[Command]string{
+	CmdGetBatteryStatus:        "getBatteryStatus",
+	CmdGetAlarmData:            "getAlarmData",
+	CmdGetSystemParameter:      "getSystemParameter",
+	CmdGetProtocolVersion:      "getProtocolVersion",
+	CmdGetManufacturerInfo:     "getManufacturerInfo",
+	CmdGetChargeManagementInfo: "getChargeManagementInfo",
+	CmdGetSeriesNumber:         "getSeriesNumber",
+	CmdSetChargeManagementInfo: "setChargeManagementInfo",
+	CmdTurnOff:                 "turnOff",
+}
+
+// Returns the name of the command, or its hex value if unknown.
+func (c Command) Name() string {
+	if name, ok := commandNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", byte(c))
+}
+
 const (
 	AllBatteries   = 0xFF
+	defaultAddress = 0x01
 	defaultVersion = 0x20
 	start          = 0x7E
 	end            = 0x0D
@@ -38,22 +57,29 @@ const (
 )
 
 func GetProtocolVersion(c connector.Connector) (string, error) {
-	encoded, err := encodeProtocolVersion()
-	if err != nil {
-		return "", err
-	}
+	return GetProtocolVersionContext(context.Background(), c)
+}
+
+func GetProtocolVersionContext(ctx context.Context, c connector.Connector) (string, error) {
+	return GetProtocolVersionAtContext(ctx, c, defaultAddress)
+}
+
+func GetProtocolVersionAt(c connector.Connector, address byte) (string, error) {
+	return GetProtocolVersionAtContext(context.Background(), c, address)
+}
 
-	response, err := sendRequest(c, encoded)
+func GetProtocolVersionAtContext(ctx context.Context, c connector.Connector, address byte) (string, error) {
+	encoded, err := encodeProtocolVersion(address)
 	if err != nil {
 		return "", err
 	}
 
-	decoded, err := parseResponse(response)
+	decoded, err := request(ctx, c, encoded)
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%02X", decoded.ver), err
+	return fmt.Sprintf("%02X", decoded.Version), err
 }
 
 type ManufacturerInfo struct {
@@ -63,31 +89,45 @@ type ManufacturerInfo struct {
 }
 
 func GetManufacturerInfo(c connector.Connector) (*ManufacturerInfo, error) {
-	encoded, err := encodeManufacturerInfo()
-	if err != nil {
-		return nil, err
-	}
+	return GetManufacturerInfoContext(context.Background(), c)
+}
+
+func GetManufacturerInfoContext(ctx context.Context, c connector.Connector) (*ManufacturerInfo, error) {
+	return GetManufacturerInfoAtContext(ctx, c, defaultAddress)
+}
 
-	response, err := sendRequest(c, encoded)
+func GetManufacturerInfoAt(c connector.Connector, address byte) (*ManufacturerInfo, error) {
+	return GetManufacturerInfoAtContext(context.Background(), c, address)
+}
+
+func GetManufacturerInfoAtContext(ctx context.Context, c connector.Connector, address byte) (*ManufacturerInfo, error) {
+	encoded, err := encodeManufacturerInfo(address)
 	if err != nil {
 		return nil, err
 	}
 
-	decoded, err := parseResponse(response)
+	decoded, err := request(ctx, c, encoded)
 	if err != nil {
 		return nil, err
 	}
 
-	return parseManufacturerInfo(decoded.info)
+	return parseManufacturerInfo(decoded.Info)
 }
 
 func parseManufacturerInfo(info []byte) (*ManufacturerInfo, error) {
+	r := &infoReader{info: info}
+	name := r.bytes(10)
+	version := r.bytes(2)
+	if r.err != nil {
+		return nil, fmt.Errorf("manufacturer info: %w", r.err)
+	}
+
 	man := &ManufacturerInfo{
-		DeviceName: strings.TrimFunc(string(info[0:10]), func(r rune) bool {
+		DeviceName: strings.TrimFunc(string(name), func(r rune) bool {
 			return r < 32
 		}),
-		SoftwareVersion:  fmt.Sprintf("%d%d", info[10], info[11]),
-		ManufacturerName: string(info[12:]),
+		SoftwareVersion:  fmt.Sprintf("%d%d", version[0], version[1]),
+		ManufacturerName: string(r.bytes(len(info) - r.pos)),
 	}
 	return man, nil
 }
@@ -111,267 +151,680 @@ type BatteryGroupStatus struct {
 }
 
 func GetBatteryStatus(c connector.Connector) (*BatteryGroupStatus, error) {
-	encoded, err := encodeBatteryStatus(1, AllBatteries)
-	if err != nil {
-		return nil, err
-	}
+	return GetBatteryStatusContext(context.Background(), c)
+}
+
+func GetBatteryStatusContext(ctx context.Context, c connector.Connector) (*BatteryGroupStatus, error) {
+	return GetBatteryStatusAtContext(ctx, c, defaultAddress)
+}
 
-	response, err := sendRequest(c, encoded)
+func GetBatteryStatusAt(c connector.Connector, address byte) (*BatteryGroupStatus, error) {
+	return GetBatteryStatusAtContext(context.Background(), c, address)
+}
+
+func GetBatteryStatusAtContext(ctx context.Context, c connector.Connector, address byte) (*BatteryGroupStatus, error) {
+	encoded, err := encodeBatteryStatus(address, AllBatteries)
 	if err != nil {
 		return nil, err
 	}
 
-	decoded, err := parseResponse(response)
+	decoded, err := request(ctx, c, encoded)
 	if err != nil {
 		return nil, err
 	}
 
-	return parseBatteryGroupStatus(decoded.info)
+	return parseBatteryGroupStatus(decoded.Info)
 }
 
 func parseBatteryGroupStatus(info []byte) (*BatteryGroupStatus, error) {
+	r := &infoReader{info: info}
 	bgs := &BatteryGroupStatus{}
-	bgs.FlagData = info[0]
-	bgs.Count = int(info[1])
+	bgs.FlagData = r.byte()
+	bgs.Count = int(r.byte())
 
-	statusLen := 0
-	for i := 0; i < bgs.Count; i++ {
+	for i := 0; i < bgs.Count && r.err == nil; i++ {
 		bs := BatteryStatus{}
-		statusStart := i*statusLen + 2
-		bs.CellCount = int(info[statusStart])
-		bs.TempCount = int(info[statusStart+bs.CellCount*2+1])
+		bs.CellCount = int(r.byte())
 		for j := 0; j < bs.CellCount; j++ {
-			bs.CellVoltage = append(bs.CellVoltage, float32(int16(binary.BigEndian.Uint16(info[statusStart+1+j*2:statusStart+1+j*2+2])))/1000.0)
+			bs.CellVoltage = append(bs.CellVoltage, float32(r.int16())/1000.0)
 		}
 
+		bs.TempCount = int(r.byte())
 		for k := 0; k < bs.TempCount; k++ {
-			deciKelvin := int16(binary.BigEndian.Uint16(info[statusStart+1+bs.CellCount*2+1+k*2 : statusStart+1+bs.CellCount*2+1+k*2+2]))
-			bs.Temperature = append(bs.Temperature, (float32(deciKelvin)-celsiusScale)/10.0)
+			bs.Temperature = append(bs.Temperature, (float32(r.int16())-celsiusScale)/10.0)
 		}
 
-		currentIndex := statusStart + 1 + bs.CellCount*2 + 1 + bs.TempCount*2
-		bs.Current = float32(int16(binary.BigEndian.Uint16(info[currentIndex:currentIndex+2]))) / 100.0
-
-		bs.TotalVoltage = float32(binary.BigEndian.Uint16(info[currentIndex+2:currentIndex+4])) / 1000.0
-		capacityIndicator := info[currentIndex+6]
-
-		//Think here
-		capacityLen := 0
-
-		if capacityIndicator == 2 {
-			bs.RemainingCapacity = float32(int(binary.BigEndian.Uint16(info[currentIndex+4:currentIndex+6]))) / 1000.0
-			bs.TotalCapacity = float32(int(binary.BigEndian.Uint16(info[currentIndex+7:currentIndex+9]))) / 1000.0
-		} else {
-			capacityLen = 6
-			rcPos := []byte{0}
-			rcPos = append(rcPos, info[currentIndex+11:currentIndex+14]...)
-			bs.RemainingCapacity = float32(int(binary.BigEndian.Uint32(rcPos))) / 1000.0
-			tcPos := []byte{0}
-			tcPos = append(tcPos, info[currentIndex+14:currentIndex+17]...)
-			bs.TotalCapacity = float32(int(binary.BigEndian.Uint32(tcPos))) / 1000.0
-
+		bs.Current = float32(r.int16()) / 100.0
+		bs.TotalVoltage = float32(r.uint16()) / 1000.0
+		remaining := uint32(r.uint16())
+
+		// The number of user defined fields following the remaining
+		// capacity, 2 for the total capacity and cycles. Packs above 65Ah
+		// report 4, with both capacities as 3 byte values after the cycles
+		// and 0xFFFF in the 2 byte fields.
+		userDefined := int(r.byte())
+		var total uint32
+		if userDefined >= 1 {
+			total = uint32(r.uint16())
 		}
-		bs.Cycles = int(binary.BigEndian.Uint16(info[currentIndex+9 : currentIndex+11]))
-
-		// Check what the length of bits used for voltage values should be.
-		if statusLen == 0 {
-			statusLen = 1 + bs.CellCount*2 + 1 + bs.TempCount*2 + 3*2 + 1 + 2*2 + capacityLen
+		if userDefined >= 2 {
+			bs.Cycles = int(r.uint16())
+		}
+		if userDefined >= 3 {
+			remaining = r.uint24()
+		}
+		if userDefined >= 4 {
+			total = r.uint24()
 		}
+		// Further fields are not documented, assumed to be 2 bytes each
+		if userDefined > 4 {
+			r.bytes(2 * (userDefined - 4))
+		}
+		bs.RemainingCapacity = float32(remaining) / 1000.0
+		bs.TotalCapacity = float32(total) / 1000.0
 
+		if r.err != nil {
+			return nil, fmt.Errorf("battery status of pack %d: %w", i+1, r.err)
+		}
 		bgs.Status = append(bgs.Status, bs)
 	}
 
+	if r.err != nil {
+		return nil, fmt.Errorf("battery status: %w", r.err)
+	}
 	return bgs, nil
 }
 
-func encodeBatteryStatus(address byte, batteryNumber byte) ([]byte, error) {
-	if batteryNumber == 0 {
-		batteryNumber = AllBatteries
-	}
+//go:generate enumer -type=AlarmState -json -text
+type AlarmState uint8
 
-	f := newFrame(address, getBatteryStatus, []byte{batteryNumber})
+const (
+	AlarmNormal          AlarmState = 0x00
+	AlarmBelowLowerLimit AlarmState = 0x01
+	AlarmAboveUpperLimit AlarmState = 0x02
+	AlarmOtherError      AlarmState = 0xF0
+)
 
-	encode, err := f.encode()
-	return encode, err
+type AlarmInfo struct {
+	CellCount        int
+	CellVoltage      []AlarmState
+	TempCount        int
+	Temperature      []AlarmState
+	ChargeCurrent    AlarmState
+	ModuleVoltage    AlarmState
+	DischargeCurrent AlarmState
+	// Status 1, protections
+	ModuleUnderVoltage       bool
+	ChargeOverTemperature    bool
+	DischargeOverTemperature bool
+	DischargeOverCurrent     bool
+	ChargeOverCurrent        bool
+	CellUnderVoltage         bool
+	ModuleOverVoltage        bool
+	// Status 2
+	UsingBatteryPower bool
+	DischargeMOSFETOn bool
+	ChargeMOSFETOn    bool
+	PreMOSFETOn       bool
+	// Status 3
+	ChargeCurrentEffective    bool
+	DischargeCurrentEffective bool
+	HeaterOn                  bool
+	FullyCharged              bool
+	BuzzerOn                  bool
+	// Status 4 and 5, per cell
+	CellError []bool
 }
 
-func encodeManufacturerInfo() ([]byte, error) {
-	f := newFrame(1, getManufacturerInfo, nil)
+// Returns true if any value is out of its limits or a protection is active.
+func (a *AlarmInfo) HasAlarm() bool {
+	for _, states := range [][]AlarmState{a.CellVoltage, a.Temperature, {a.ChargeCurrent, a.ModuleVoltage, a.DischargeCurrent}} {
+		for _, state := range states {
+			if state != AlarmNormal {
+				return true
+			}
+		}
+	}
+	for _, cellError := range a.CellError {
+		if cellError {
+			return true
+		}
+	}
+	return a.ModuleUnderVoltage || a.ChargeOverTemperature || a.DischargeOverTemperature || a.DischargeOverCurrent ||
+		a.ChargeOverCurrent || a.CellUnderVoltage || a.ModuleOverVoltage
+}
 
-	encode, err := f.encode()
-	return encode, err
+type AlarmGroupInfo struct {
+	FlagData byte
+	Count    int
+	Alarms   []AlarmInfo
 }
 
-func encodeProtocolVersion() ([]byte, error) {
-	f := newFrame(1, getProtocolVersion, nil)
+func GetAlarmInfo(c connector.Connector) (*AlarmGroupInfo, error) {
+	return GetAlarmInfoContext(context.Background(), c)
+}
 
-	encode, err := f.encode()
-	return encode, err
+func GetAlarmInfoContext(ctx context.Context, c connector.Connector) (*AlarmGroupInfo, error) {
+	return GetAlarmInfoAtContext(ctx, c, defaultAddress)
 }
 
-func parseResponse(response []byte) (*frame, error) {
-	log.Printf("received response: [%s]", string(response[:len(response)-1]))
-	respData, err := validateResponse(response)
+func GetAlarmInfoAt(c connector.Connector, address byte) (*AlarmGroupInfo, error) {
+	return GetAlarmInfoAtContext(context.Background(), c, address)
+}
+
+func GetAlarmInfoAtContext(ctx context.Context, c connector.Connector, address byte) (*AlarmGroupInfo, error) {
+	encoded, err := NewFrame(address, CmdGetAlarmData, []byte{AllBatteries}).Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := request(ctx, c, encoded)
 	if err != nil {
 		return nil, err
 	}
 
-	f := &frame{}
-	f.ver = hex2Byte(respData[0:2])
-	f.adr = hex2Byte(respData[2:4])
-	f.cid1 = hex2Byte(respData[4:6])
-	f.cid2 = command(hex2Byte(respData[6:8]))
+	return parseAlarmGroupInfo(decoded.Info)
+}
 
-	infoLen := uint16(hex2Byte(respData[8:10]))<<8 | uint16(hex2Byte(respData[10:12]))
-	var info []byte
-	if len(respData) > 12 {
-		info = respData[12:]
+func parseAlarmGroupInfo(info []byte) (*AlarmGroupInfo, error) {
+	r := &infoReader{info: info}
+	agi := &AlarmGroupInfo{}
+	agi.FlagData = r.byte()
+	agi.Count = int(r.byte())
+
+	for i := 0; i < agi.Count && r.err == nil; i++ {
+		a := AlarmInfo{}
+		a.CellCount = int(r.byte())
+		for _, b := range r.bytes(a.CellCount) {
+			a.CellVoltage = append(a.CellVoltage, AlarmState(b))
+		}
+		a.TempCount = int(r.byte())
+		for _, b := range r.bytes(a.TempCount) {
+			a.Temperature = append(a.Temperature, AlarmState(b))
+		}
+		a.ChargeCurrent = AlarmState(r.byte())
+		a.ModuleVoltage = AlarmState(r.byte())
+		a.DischargeCurrent = AlarmState(r.byte())
+
+		status1 := r.byte()
+		a.ModuleUnderVoltage = status1&0x80 == 0x80
+		a.ChargeOverTemperature = status1&0x40 == 0x40
+		a.DischargeOverTemperature = status1&0x20 == 0x20
+		a.DischargeOverCurrent = status1&0x10 == 0x10
+		a.ChargeOverCurrent = status1&0x04 == 0x04
+		a.CellUnderVoltage = status1&0x02 == 0x02
+		a.ModuleOverVoltage = status1&0x01 == 0x01
+
+		status2 := r.byte()
+		a.UsingBatteryPower = status2&0x08 == 0x08
+		a.DischargeMOSFETOn = status2&0x04 == 0x04
+		a.ChargeMOSFETOn = status2&0x02 == 0x02
+		a.PreMOSFETOn = status2&0x01 == 0x01
+
+		status3 := r.byte()
+		a.ChargeCurrentEffective = status3&0x80 == 0x80
+		a.DischargeCurrentEffective = status3&0x40 == 0x40
+		a.HeaterOn = status3&0x20 == 0x20
+		a.FullyCharged = status3&0x08 == 0x08
+		a.BuzzerOn = status3&0x01 == 0x01
+
+		status4 := r.byte()
+		status5 := r.byte()
+		cellErrors := uint16(status5)<<8 | uint16(status4)
+		for j := 0; j < a.CellCount; j++ {
+			a.CellError = append(a.CellError, j < 16 && cellErrors&(1<<j) != 0)
+		}
+
+		agi.Alarms = append(agi.Alarms, a)
 	}
 
-	lenCheck, err := lengthChecksum(len(info))
+	if r.err != nil {
+		return nil, r.err
+	}
+	return agi, nil
+}
+
+// SystemParameters are the limits reported by the battery, voltages in V,
+// temperatures in °C and currents in A. The discharge current limit is
+// negative.
+type SystemParameters struct {
+	FlagData                      byte
+	CellHighVoltageLimit          float32
+	CellLowVoltageLimit           float32
+	CellUnderVoltageLimit         float32
+	ChargeHighTemperatureLimit    float32
+	ChargeLowTemperatureLimit     float32
+	ChargeCurrentLimit            float32
+	ModuleHighVoltageLimit        float32
+	ModuleLowVoltageLimit         float32
+	ModuleUnderVoltageLimit       float32
+	DischargeHighTemperatureLimit float32
+	DischargeLowTemperatureLimit  float32
+	DischargeCurrentLimit         float32
+}
+
+func GetSystemParameters(c connector.Connector) (*SystemParameters, error) {
+	return GetSystemParametersContext(context.Background(), c)
+}
+
+func GetSystemParametersContext(ctx context.Context, c connector.Connector) (*SystemParameters, error) {
+	return GetSystemParametersAtContext(ctx, c, defaultAddress)
+}
+
+func GetSystemParametersAt(c connector.Connector, address byte) (*SystemParameters, error) {
+	return GetSystemParametersAtContext(context.Background(), c, address)
+}
+
+func GetSystemParametersAtContext(ctx context.Context, c connector.Connector, address byte) (*SystemParameters, error) {
+	encoded, err := NewFrame(address, CmdGetSystemParameter, nil).Encode()
 	if err != nil {
 		return nil, err
 	}
-	if lenCheck != infoLen {
-		return nil, fmt.Errorf("invalid length, received %v, calculated %v", infoLen, lenCheck)
+
+	decoded, err := request(ctx, c, encoded)
+	if err != nil {
+		return nil, err
 	}
-	f.info = hex2Bytes(info)
 
-	return f, nil
+	return parseSystemParameters(decoded.Info)
 }
 
-func hex2Bytes(hexBytes []byte) []byte {
-	hexLen := len(hexBytes)
-	if hexLen%2 != 0 {
-		return nil
+func parseSystemParameters(info []byte) (*SystemParameters, error) {
+	r := &infoReader{info: info}
+	millivolts := func() float32 { return float32(r.uint16()) / 1000.0 }
+	deciKelvin := func() float32 { return (float32(r.int16()) - celsiusScale) / 10.0 }
+	centiAmps := func() float32 { return float32(r.int16()) / 100.0 }
+
+	sp := &SystemParameters{}
+	sp.FlagData = r.byte()
+	sp.CellHighVoltageLimit = millivolts()
+	sp.CellLowVoltageLimit = millivolts()
+	sp.CellUnderVoltageLimit = millivolts()
+	sp.ChargeHighTemperatureLimit = deciKelvin()
+	sp.ChargeLowTemperatureLimit = deciKelvin()
+	sp.ChargeCurrentLimit = centiAmps()
+	sp.ModuleHighVoltageLimit = millivolts()
+	sp.ModuleLowVoltageLimit = millivolts()
+	sp.ModuleUnderVoltageLimit = millivolts()
+	sp.DischargeHighTemperatureLimit = deciKelvin()
+	sp.DischargeLowTemperatureLimit = deciKelvin()
+	sp.DischargeCurrentLimit = centiAmps()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return sp, nil
+}
+
+// ChargeManagementInfo are the charge limits recommended by the BMS of a
+// pack, voltages in V and currents in A. The discharge current limit is
+// negative.
+type ChargeManagementInfo struct {
+	ChargeVoltageLimit    float32
+	DischargeVoltageLimit float32
+	ChargeCurrentLimit    float32
+	DischargeCurrentLimit float32
+	ChargeEnabled         bool
+	DischargeEnabled      bool
+	// Charge immediately, requested at a state of charge of 5-9%
+	ForceCharge1 bool
+	// Charge immediately, requested at a state of charge of 9-13%
+	ForceCharge2      bool
+	FullChargeRequest bool
+}
+
+// Returns an error matching ErrOutOfRange if a limit exceeds the system
+// parameters of the battery.
+func (cmi *ChargeManagementInfo) Validate(sp *SystemParameters) error {
+	switch {
+	case cmi.ChargeVoltageLimit <= 0 || cmi.ChargeVoltageLimit > sp.ModuleHighVoltageLimit:
+		return fmt.Errorf("%w: charge voltage limit %.3fV, maximum %.3fV", ErrOutOfRange, cmi.ChargeVoltageLimit, sp.ModuleHighVoltageLimit)
+	case cmi.DischargeVoltageLimit < sp.ModuleUnderVoltageLimit:
+		return fmt.Errorf("%w: discharge voltage limit %.3fV, minimum %.3fV", ErrOutOfRange, cmi.DischargeVoltageLimit, sp.ModuleUnderVoltageLimit)
+	case cmi.DischargeVoltageLimit >= cmi.ChargeVoltageLimit:
+		return fmt.Errorf("%w: discharge voltage limit %.3fV must be below charge voltage limit %.3fV", ErrOutOfRange, cmi.DischargeVoltageLimit, cmi.ChargeVoltageLimit)
+	case cmi.ChargeCurrentLimit < 0 || cmi.ChargeCurrentLimit > sp.ChargeCurrentLimit:
+		return fmt.Errorf("%w: charge current limit %.1fA, maximum %.1fA", ErrOutOfRange, cmi.ChargeCurrentLimit, sp.ChargeCurrentLimit)
+	case cmi.DischargeCurrentLimit > 0 || cmi.DischargeCurrentLimit < sp.DischargeCurrentLimit:
+		return fmt.Errorf("%w: discharge current limit %.1fA, minimum %.1fA", ErrOutOfRange, cmi.DischargeCurrentLimit, sp.DischargeCurrentLimit)
+	}
+	return nil
+}
+
+func GetChargeManagementInfo(c connector.Connector, batteryNumber byte) (*ChargeManagementInfo, error) {
+	return GetChargeManagementInfoContext(context.Background(), c, batteryNumber)
+}
+
+func GetChargeManagementInfoContext(ctx context.Context, c connector.Connector, batteryNumber byte) (*ChargeManagementInfo, error) {
+	return GetChargeManagementInfoAtContext(ctx, c, defaultAddress, batteryNumber)
+}
+
+func GetChargeManagementInfoAt(c connector.Connector, address byte, batteryNumber byte) (*ChargeManagementInfo, error) {
+	return GetChargeManagementInfoAtContext(context.Background(), c, address, batteryNumber)
+}
+
+func GetChargeManagementInfoAtContext(ctx context.Context, c connector.Connector, address byte, batteryNumber byte) (*ChargeManagementInfo, error) {
+	encoded, err := NewFrame(address, CmdGetChargeManagementInfo, []byte{batteryNumber}).Encode()
+	if err != nil {
+		return nil, err
 	}
 
-	bs := make([]byte, 0, hexLen/2)
-	for i := 0; i < hexLen; i += 2 {
-		bs = append(bs, hex2Byte(hexBytes[i:i+2]))
+	decoded, err := request(ctx, c, encoded)
+	if err != nil {
+		return nil, err
 	}
-	return bs
+
+	return parseChargeManagementInfo(decoded.Info)
 }
 
-func hex2Byte(hexBytes []byte) byte {
-	if len(hexBytes) > 2 {
-		return 0
+// Validates cmi against the system parameters reported by the battery
+// before setting it for the given pack.
+func SetChargeManagementInfo(c connector.Connector, batteryNumber byte, cmi *ChargeManagementInfo) error {
+	return SetChargeManagementInfoContext(context.Background(), c, batteryNumber, cmi)
+}
+
+func SetChargeManagementInfoContext(ctx context.Context, c connector.Connector, batteryNumber byte, cmi *ChargeManagementInfo) error {
+	return SetChargeManagementInfoAtContext(ctx, c, defaultAddress, batteryNumber, cmi)
+}
+
+func SetChargeManagementInfoAt(c connector.Connector, address byte, batteryNumber byte, cmi *ChargeManagementInfo) error {
+	return SetChargeManagementInfoAtContext(context.Background(), c, address, batteryNumber, cmi)
+}
+
+func SetChargeManagementInfoAtContext(ctx context.Context, c connector.Connector, address byte, batteryNumber byte, cmi *ChargeManagementInfo) error {
+	sp, err := GetSystemParametersAtContext(ctx, c, address)
+	if err != nil {
+		return err
 	}
-	parsed, err := strconv.ParseUint(string(hexBytes), 16, 16)
+	err = cmi.Validate(sp)
 	if err != nil {
-		return 0
+		return err
+	}
+
+	encoded, err := NewFrame(address, CmdSetChargeManagementInfo, encodeChargeManagementInfo(batteryNumber, cmi)).Encode()
+	if err != nil {
+		return err
 	}
 
-	return byte(parsed)
+	_, err = request(ctx, c, encoded)
+	return err
+}
+
+// The info starts with the pack number, followed by the limits in mV and
+// 100mA and the status flags.
+func parseChargeManagementInfo(info []byte) (*ChargeManagementInfo, error) {
+	r := &infoReader{info: info}
+	r.byte()
+
+	cmi := &ChargeManagementInfo{}
+	cmi.ChargeVoltageLimit = float32(r.uint16()) / 1000.0
+	cmi.DischargeVoltageLimit = float32(r.uint16()) / 1000.0
+	cmi.ChargeCurrentLimit = float32(r.int16()) / 10.0
+	cmi.DischargeCurrentLimit = float32(r.int16()) / 10.0
+
+	status := r.byte()
+	cmi.ChargeEnabled = status&0x80 == 0x80
+	cmi.DischargeEnabled = status&0x40 == 0x40
+	cmi.ForceCharge1 = status&0x20 == 0x20
+	cmi.ForceCharge2 = status&0x10 == 0x10
+	cmi.FullChargeRequest = status&0x08 == 0x08
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return cmi, nil
+}
+
+func encodeChargeManagementInfo(batteryNumber byte, cmi *ChargeManagementInfo) []byte {
+	info := []byte{batteryNumber}
+	info = binary.BigEndian.AppendUint16(info, uint16(math.Round(float64(cmi.ChargeVoltageLimit)*1000)))
+	info = binary.BigEndian.AppendUint16(info, uint16(math.Round(float64(cmi.DischargeVoltageLimit)*1000)))
+	info = binary.BigEndian.AppendUint16(info, uint16(int16(math.Round(float64(cmi.ChargeCurrentLimit)*10))))
+	info = binary.BigEndian.AppendUint16(info, uint16(int16(math.Round(float64(cmi.DischargeCurrentLimit)*10))))
+
+	status := bits(false, false, false, cmi.FullChargeRequest, cmi.ForceCharge2, cmi.ForceCharge1, cmi.DischargeEnabled, cmi.ChargeEnabled)
+	return append(info, status)
 }
 
-func validateResponse(response []byte) ([]byte, error) {
-	rlen := len(response)
-	if rlen == 0 {
-		return nil, fmt.Errorf("response is empty")
+// Returns the serial number of a pack, numbered from 1 as in
+// BatteryGroupStatus.
+func GetSerialNumber(c connector.Connector, batteryNumber byte) (string, error) {
+	return GetSerialNumberContext(context.Background(), c, batteryNumber)
+}
+
+func GetSerialNumberContext(ctx context.Context, c connector.Connector, batteryNumber byte) (string, error) {
+	return GetSerialNumberAtContext(ctx, c, defaultAddress, batteryNumber)
+}
+
+func GetSerialNumberAt(c connector.Connector, address byte, batteryNumber byte) (string, error) {
+	return GetSerialNumberAtContext(context.Background(), c, address, batteryNumber)
+}
+
+func GetSerialNumberAtContext(ctx context.Context, c connector.Connector, address byte, batteryNumber byte) (string, error) {
+	encoded, err := NewFrame(address, CmdGetSeriesNumber, []byte{batteryNumber}).Encode()
+	if err != nil {
+		return "", err
 	}
-	if response[0] != start {
-		return nil, fmt.Errorf("invalid response start %v", response[0])
+
+	decoded, err := request(ctx, c, encoded)
+	if err != nil {
+		return "", err
 	}
-	if response[rlen-1] != end {
-		return nil, fmt.Errorf("invalid response end %v", response[rlen-1])
+
+	return parseSerialNumber(decoded.Info)
+}
+
+// The info holds the pack number followed by the serial number, padded to
+// 16 bytes. Packs without a serial number send padding only.
+func parseSerialNumber(info []byte) (string, error) {
+	if len(info) < 2 {
+		return "", fmt.Errorf("%w: serial number of %d bytes", ErrShortResponse, len(info))
+	}
+	serialNumber := strings.TrimFunc(string(info[1:]), func(r rune) bool {
+		return r <= ' '
+	})
+	if serialNumber == "" {
+		return "", fmt.Errorf("%w: serial number is padding only", ErrShortResponse)
 	}
-	checkStart := rlen - 5
-	respData := response[1:checkStart]
-	respCheck := string(response[checkStart : rlen-1])
-	dataSum, err := frameChecksum(string(respData))
+	return serialNumber, nil
+}
+
+// PackIdentity identifies a physical pack, regardless of its position in the
+// battery group.
+type PackIdentity struct {
+	SerialNumber     string
+	ManufacturerInfo ManufacturerInfo
+	ProtocolVersion  string
+}
+
+func GetPackIdentity(c connector.Connector, batteryNumber byte) (*PackIdentity, error) {
+	return GetPackIdentityContext(context.Background(), c, batteryNumber)
+}
+
+func GetPackIdentityContext(ctx context.Context, c connector.Connector, batteryNumber byte) (*PackIdentity, error) {
+	return GetPackIdentityAtContext(ctx, c, defaultAddress, batteryNumber)
+}
+
+func GetPackIdentityAt(c connector.Connector, address byte, batteryNumber byte) (*PackIdentity, error) {
+	return GetPackIdentityAtContext(context.Background(), c, address, batteryNumber)
+}
+
+func GetPackIdentityAtContext(ctx context.Context, c connector.Connector, address byte, batteryNumber byte) (*PackIdentity, error) {
+	serialNumber, err := GetSerialNumberAtContext(ctx, c, address, batteryNumber)
 	if err != nil {
 		return nil, err
 	}
-	checkSum, err := strconv.ParseUint(respCheck, 16, 16)
+	manufacturerInfo, err := GetManufacturerInfoAtContext(ctx, c, address)
 	if err != nil {
 		return nil, err
 	}
-	if uint16(checkSum) != dataSum {
-		return nil, fmt.Errorf("invalid checksum, received: %v, calculated: %v", checkSum, dataSum)
+	version, err := GetProtocolVersionAtContext(ctx, c, address)
+	if err != nil {
+		return nil, err
 	}
 
-	return respData, nil
+	return &PackIdentity{
+		SerialNumber:     serialNumber,
+		ManufacturerInfo: *manufacturerInfo,
+		ProtocolVersion:  version,
+	}, nil
+}
+
+// Turns a pack off. As this cuts its power, the serial number of the pack
+// has to be passed as confirmation, the pack is not turned off and
+// ErrNotConfirmed is returned if it does not match.
+func TurnOff(c connector.Connector, batteryNumber byte, confirmSerialNumber string) error {
+	return TurnOffContext(context.Background(), c, batteryNumber, confirmSerialNumber)
+}
+
+func TurnOffContext(ctx context.Context, c connector.Connector, batteryNumber byte, confirmSerialNumber string) error {
+	return TurnOffAtContext(ctx, c, defaultAddress, batteryNumber, confirmSerialNumber)
 }
 
-func sendRequest(c connector.Connector, encoded []byte) ([]byte, error) {
-	err := c.Write(encoded)
+func TurnOffAt(c connector.Connector, address byte, batteryNumber byte, confirmSerialNumber string) error {
+	return TurnOffAtContext(context.Background(), c, address, batteryNumber, confirmSerialNumber)
+}
+
+func TurnOffAtContext(ctx context.Context, c connector.Connector, address byte, batteryNumber byte, confirmSerialNumber string) error {
+	if batteryNumber == 0 || batteryNumber == AllBatteries {
+		return fmt.Errorf("%w: invalid pack %d", ErrNotConfirmed, batteryNumber)
+	}
+	if confirmSerialNumber == "" {
+		return fmt.Errorf("%w: no serial number given for pack %d", ErrNotConfirmed, batteryNumber)
+	}
+
+	serialNumber, err := GetSerialNumberAtContext(ctx, c, address, batteryNumber)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if serialNumber != confirmSerialNumber {
+		return fmt.Errorf("%w: pack %d has serial number %q", ErrNotConfirmed, batteryNumber, serialNumber)
 	}
-	readBytes, err := c.ReadUntilCR()
+
+	encoded, err := NewFrame(address, CmdTurnOff, []byte{batteryNumber}).Encode()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return readBytes, nil
-}
 
-type frame struct {
-	ver  byte
-	adr  byte
-	cid1 byte
-	cid2 command
-	info []byte
+	_, err = request(ctx, c, encoded)
+	return err
 }
 
-func newFrame(address byte, command command, info []byte) *frame {
-	return &frame{
-		ver:  defaultVersion,
-		adr:  address,
-		cid1: batteryData,
-		cid2: command,
-		info: info,
+func encodeBatteryStatus(address byte, batteryNumber byte) ([]byte, error) {
+	if batteryNumber == 0 {
+		batteryNumber = AllBatteries
 	}
+
+	f := NewFrame(address, CmdGetBatteryStatus, []byte{batteryNumber})
+
+	encode, err := f.Encode()
+	return encode, err
 }
 
-func (f *frame) encode() ([]byte, error) {
-	buf := bytes.Buffer{}
-	info := hex.EncodeUpperToString(f.info)
-	length, err := lengthChecksum(len(info))
+func encodeManufacturerInfo(address byte) ([]byte, error) {
+	f := NewFrame(address, CmdGetManufacturerInfo, nil)
+
+	encode, err := f.Encode()
+	return encode, err
+}
+
+func encodeProtocolVersion(address byte) ([]byte, error) {
+	f := NewFrame(address, CmdGetProtocolVersion, nil)
+
+	encode, err := f.Encode()
+	return encode, err
+}
+
+func sendRequest(ctx context.Context, c connector.Connector, encoded []byte) ([]byte, error) {
+	logger.Load().Debug("sending request", "frame", string(bytes.TrimSuffix(encoded, []byte{end})))
+	err := connector.WriteContext(ctx, c, encoded)
 	if err != nil {
 		return nil, err
 	}
-	buf.WriteByte(start)
-	data := fmt.Sprintf("%02X%02X%02X%02X%04X%s", f.ver, f.adr, f.cid1, byte(f.cid2), length, info)
-	buf.WriteString(data)
-	checksum, err := frameChecksum(data)
+	readBytes, err := connector.ReadContext(ctx, c, end)
 	if err != nil {
 		return nil, err
 	}
-	buf.WriteString(fmt.Sprintf("%04X", checksum))
-	buf.WriteByte(end)
-	log.Printf("Encoded: %s", buf.String())
-	return buf.Bytes(), nil
+	return readBytes, nil
 }
 
-func lengthChecksum(len int) (uint16, error) {
-	if len < 0 {
-		return 0, fmt.Errorf("invalid length, must be >= 0")
-	}
-	if len > 0x0FFF {
-		return 0, fmt.Errorf("invalid length, must be <= %d", 0xFFF)
+// Sends an encoded request and decodes the response, returns a
+// ResponseError if the battery reports an error.
+func request(ctx context.Context, c connector.Connector, encoded []byte) (*Frame, error) {
+	response, err := sendRequest(ctx, c, encoded)
+	if err != nil {
+		return nil, err
 	}
 
-	if len == 0 {
-		return 0, nil
+	logger.Load().Debug("received response", "frame", string(bytes.TrimSuffix(response, []byte{end})))
+	decoded, err := DecodeFrame(response)
+	if err != nil {
+		return nil, err
+	}
+	if decoded.CID2 != rtnNormal {
+		return nil, &ResponseError{Code: byte(decoded.CID2)}
 	}
 
-	ulen := uint16(len)
-	length := (ulen & 0x000F) + ((ulen >> 4) & 0x000F) + ((ulen >> 8) & 0x000F)
+	return decoded, nil
+}
 
-	length = (^(length%0x10)+1)<<12 + ulen
+// Reads fields from a decoded info payload. Reading past the end yields
+// zeros and sets err to ErrShortResponse, so a payload can be decoded
+// without checking every field.
+type infoReader struct {
+	info []byte
+	pos  int
+	err  error
+}
 
-	return length, nil
+func (r *infoReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.info) {
+		r.err = fmt.Errorf("%w: need %d bytes at offset %d of %d", ErrShortResponse, n, r.pos, len(r.info))
+		return nil
+	}
+	bs := r.info[r.pos : r.pos+n]
+	r.pos += n
+	return bs
 }
 
-func frameChecksum(frameData string) (uint16, error) {
-	bs := []byte(strings.ToUpper(frameData))
-	var sum uint16
-	for _, b := range bs {
-		sum += uint16(b)
+func (r *infoReader) byte() byte {
+	bs := r.bytes(1)
+	if bs == nil {
+		return 0
 	}
+	return bs[0]
+}
+
+func (r *infoReader) uint16() uint16 {
+	bs := r.bytes(2)
+	if bs == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(bs)
+}
+
+func (r *infoReader) int16() int16 {
+	return int16(r.uint16())
+}
 
-	sum = ^uint16(uint32(sum)%0x10000) + 1
+func (r *infoReader) uint24() uint32 {
+	bs := r.bytes(3)
+	if bs == nil {
+		return 0
+	}
+	return uint32(bs[0])<<16 | uint32(bs[1])<<8 | uint32(bs[2])
+}
 
-	return sum, nil
+// Packs flags into a byte, the first one being bit 0.
+func bits(flags ...bool) byte {
+	var b byte
+	for i, set := range flags {
+		if set {
+			b |= 1 << i
+		}
+	}
+	return b
 }
@@ -1,9 +1,12 @@
 package pylontech
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -67,7 +70,7 @@ func Test_frameChecksum(t *testing.T) {
 
 func Test_encodeProtocolVersion(t *testing.T) {
 	want := "~2001464F0000FD99\r"
-	got, err := encodeProtocolVersion()
+	got, err := encodeProtocolVersion(1)
 	fmt.Println(string(got))
 
 	if err != nil {
@@ -83,43 +86,43 @@ func Test_encodeProtocolVersion(t *testing.T) {
 
 func Test_parseProtocolVersionResponse(t *testing.T) {
 	want := "~200146000000FDB3\r"
-	got, err := parseResponse([]byte(want))
+	got, err := DecodeFrame([]byte(want))
 	fmt.Println(got)
 
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("DecodeFrame() error = %v", err)
 		return
 	}
 
-	bytes, err := got.encode()
+	bytes, err := got.Encode()
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("Encode() error = %v", err)
 		return
 	}
 
 	if string(bytes) != want {
-		t.Errorf("parseResponse() got = %v, want %v", string(bytes), want)
+		t.Errorf("Encode() got = %v, want %v", string(bytes), want)
 	}
 }
 
 func Test_parseManufacturerInfoResponse(t *testing.T) {
 	want := "~20014600C0405553324B42504C000000020150796C6F6E2D2D2D2D2D2D2D2D2D2D2D2D2D2D2DEF9B\r"
-	got, err := parseResponse([]byte(want))
+	got, err := DecodeFrame([]byte(want))
 	fmt.Println(got)
 
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("DecodeFrame() error = %v", err)
 		return
 	}
 
-	bytes, err := got.encode()
+	bytes, err := got.Encode()
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("Encode() error = %v", err)
 		return
 	}
 
 	if string(bytes) != want {
-		t.Errorf("parseResponse() got = %v, want %v", string(bytes), want)
+		t.Errorf("Encode() got = %v, want %v", string(bytes), want)
 	}
 
 }
@@ -129,13 +132,13 @@ func Test_parseManufacturerInfo(t *testing.T) {
 
 	resp := "~20014600C0405553324B42504C000000020150796C6F6E2D2D2D2D2D2D2D2D2D2D2D2D2D2D2DEF9B\r"
 
-	f, err := parseResponse([]byte(resp))
+	f, err := DecodeFrame([]byte(resp))
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("DecodeFrame() error = %v", err)
 		return
 	}
 
-	got, err := parseManufacturerInfo(f.info)
+	got, err := parseManufacturerInfo(f.Info)
 	if err != nil {
 		t.Errorf("parseManufacturerInfo() error = %v", err)
 		return
@@ -163,13 +166,13 @@ func Test_parseBatteryGroupStatusUS2000B(t *testing.T) {
 	resp :=
 		"~20014600B0D811020F0D6F0D6F0D6D0D6F0D6C0D6E0D6F0D6E0D760D780D760D780D770D780D76050BAF0B7D0B7D0B7D0B7D0000C9B2C35002C35000050F0DEE0DF80DF50DF20DF00DEE0DF60DF60E040E020E030E030E030E040E04050BB90B7D0B7D0B7D0B7D0000D1AEC35002C3500011CD77\r"
 
-	f, err := parseResponse([]byte(resp))
+	f, err := DecodeFrame([]byte(resp))
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("DecodeFrame() error = %v", err)
 		return
 	}
 
-	got, err := parseBatteryGroupStatus(f.info)
+	got, err := parseBatteryGroupStatus(f.Info)
 	bytes, err := json.Marshal(got)
 	fmt.Println(string(bytes))
 
@@ -185,13 +188,13 @@ func Test_parseBatteryGroupStatusUS3000A(t *testing.T) {
 	resp :=
 		"~2001460010F011020F0D1A0D220D220D200D1D0D210D1D0D190D1A0D1E0D210D1F0D1C0D1A0D1C050BB90BB90BB90BC30BB900BEC4BCFFFF04FFFF010A00BEC80121100F0D220D230D1F0D1C0D1C0D1C0D1C0D1A0D1C0D1D0D1D0D1C0D1C0D1C0D1D050BC30BB90BB90BB90BB900BDC4B5FFFF04FFFF010600B900012110C7D3\r"
 
-	f, err := parseResponse([]byte(resp))
+	f, err := DecodeFrame([]byte(resp))
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("DecodeFrame() error = %v", err)
 		return
 	}
 
-	got, err := parseBatteryGroupStatus(f.info)
+	got, err := parseBatteryGroupStatus(f.Info)
 	bytes, err := json.Marshal(got)
 	fmt.Println(string(bytes))
 
@@ -211,13 +214,13 @@ func Test_parseBatteryGroupStatusNegativeCurrent(t *testing.T) {
 	resp :=
 		"~2001460010F011020F0D6F0D780D770D770D740D740D740D720D7B0D790D7A0D7A0D790D7A0D77050BCD0BC30BC30BCD0BC3FFFEC9F5FFFF04FFFF010A0126D80121100F0D770D780D790D790D780D780D780D690D7A0D790D760D780D780D790D78050BCD0BC30BC30BCD0BC3FFFEC9FCFFFF04FFFF01060126D8012110C74C\r"
 
-	f, err := parseResponse([]byte(resp))
+	f, err := DecodeFrame([]byte(resp))
 	if err != nil {
-		t.Errorf("parseResponse() error = %v", err)
+		t.Errorf("DecodeFrame() error = %v", err)
 		return
 	}
 
-	got, err := parseBatteryGroupStatus(f.info)
+	got, err := parseBatteryGroupStatus(f.Info)
 	bytes, err := json.Marshal(got)
 	fmt.Println(string(bytes))
 
@@ -231,3 +234,283 @@ func Test_parseBatteryGroupStatusNegativeCurrent(t *testing.T) {
 	}
 
 }
+
+func Test_encodeAlarmInfo(t *testing.T) {
+	want := "~20014644E002FFFD08\r"
+	got, err := NewFrame(1, CmdGetAlarmData, []byte{AllBatteries}).Encode()
+	if err != nil {
+		t.Errorf("encode() error = %v", err)
+		return
+	}
+	if string(got) != want {
+		t.Errorf("encode() got = %v, want %v", string(got), want)
+	}
+}
+
+func Test_parseAlarmGroupInfo(t *testing.T) {
+	resp := "~20014600C04000011000000200000000000000000000000000040000F000000000020E800400F15B\r"
+
+	f, err := DecodeFrame([]byte(resp))
+	if err != nil {
+		t.Errorf("DecodeFrame() error = %v", err)
+		return
+	}
+
+	got, err := parseAlarmGroupInfo(f.Info)
+	if err != nil {
+		t.Errorf("parseAlarmGroupInfo() error = %v", err)
+		return
+	}
+	if got.Count != 1 || len(got.Alarms) != 1 {
+		t.Fatalf("parseAlarmGroupInfo() got %d packs, want 1", len(got.Alarms))
+	}
+
+	a := got.Alarms[0]
+	if a.CellCount != 16 || a.CellVoltage[2] != AlarmAboveUpperLimit || a.CellVoltage[3] != AlarmNormal {
+		t.Errorf("parseAlarmGroupInfo() cell alarms got = %v", a.CellVoltage)
+	}
+	if a.TempCount != 4 || a.Temperature[2] != AlarmOtherError {
+		t.Errorf("parseAlarmGroupInfo() temperature alarms got = %v", a.Temperature)
+	}
+	if !a.CellUnderVoltage || a.ModuleOverVoltage || !a.ChargeMOSFETOn || !a.DischargeMOSFETOn || !a.UsingBatteryPower || !a.ChargeCurrentEffective {
+		t.Errorf("parseAlarmGroupInfo() status got = %+v", a)
+	}
+	if !a.CellError[2] || a.CellError[0] {
+		t.Errorf("parseAlarmGroupInfo() cell errors got = %v", a.CellError)
+	}
+	if !a.HasAlarm() {
+		t.Error("HasAlarm() got = false, want true")
+	}
+
+	_, err = parseAlarmGroupInfo(f.Info[:20])
+	if !errors.Is(err, ErrShortResponse) {
+		t.Errorf("parseAlarmGroupInfo() error = %v, want %v", err, ErrShortResponse)
+	}
+}
+
+func Test_parseSystemParameters(t *testing.T) {
+	resp := "~20014600B032110E420BB80AF00C9F0AAB2710CD14BB80AFC80CD109E3C568F253\r"
+
+	f, err := DecodeFrame([]byte(resp))
+	if err != nil {
+		t.Errorf("DecodeFrame() error = %v", err)
+		return
+	}
+
+	got, err := parseSystemParameters(f.Info)
+	if err != nil {
+		t.Errorf("parseSystemParameters() error = %v", err)
+		return
+	}
+
+	want := SystemParameters{
+		FlagData:                      0x11,
+		CellHighVoltageLimit:          3.65,
+		CellLowVoltageLimit:           3.0,
+		CellUnderVoltageLimit:         2.8,
+		ChargeHighTemperatureLimit:    50,
+		ChargeLowTemperatureLimit:     0,
+		ChargeCurrentLimit:            100,
+		ModuleHighVoltageLimit:        52.5,
+		ModuleLowVoltageLimit:         48,
+		ModuleUnderVoltageLimit:       45,
+		DischargeHighTemperatureLimit: 55,
+		DischargeLowTemperatureLimit:  -20,
+		DischargeCurrentLimit:         -150,
+	}
+	if *got != want {
+		t.Errorf("parseSystemParameters() got = %+v, want %+v", *got, want)
+	}
+
+	_, err = parseSystemParameters(f.Info[:10])
+	if !errors.Is(err, ErrShortResponse) {
+		t.Errorf("parseSystemParameters() error = %v, want %v", err, ErrShortResponse)
+	}
+}
+
+func Test_parseChargeManagementInfo(t *testing.T) {
+	resp := "~20014600B01402CFD0B79800FAFE0CA8F8F5\r"
+
+	f, err := DecodeFrame([]byte(resp))
+	if err != nil {
+		t.Errorf("DecodeFrame() error = %v", err)
+		return
+	}
+
+	got, err := parseChargeManagementInfo(f.Info)
+	if err != nil {
+		t.Errorf("parseChargeManagementInfo() error = %v", err)
+		return
+	}
+
+	want := ChargeManagementInfo{
+		ChargeVoltageLimit:    53.2,
+		DischargeVoltageLimit: 47,
+		ChargeCurrentLimit:    25,
+		DischargeCurrentLimit: -50,
+		ChargeEnabled:         true,
+		ForceCharge1:          true,
+		FullChargeRequest:     true,
+	}
+	if *got != want {
+		t.Errorf("parseChargeManagementInfo() got = %+v, want %+v", *got, want)
+	}
+
+	if encoded := encodeChargeManagementInfo(2, got); !bytes.Equal(encoded, f.Info) {
+		t.Errorf("encodeChargeManagementInfo() got = %X, want %X", encoded, f.Info)
+	}
+}
+
+func TestChargeManagementInfo_Validate(t *testing.T) {
+	sp := &SystemParameters{ChargeCurrentLimit: 37, ModuleHighVoltageLimit: 54, ModuleUnderVoltageLimit: 44, DischargeCurrentLimit: -37}
+	valid := ChargeManagementInfo{ChargeVoltageLimit: 53.2, DischargeVoltageLimit: 44.5, ChargeCurrentLimit: 37, DischargeCurrentLimit: -37}
+
+	tests := []struct {
+		name    string
+		modify  func(cmi *ChargeManagementInfo)
+		wantErr bool
+		wantMsg string
+	}{
+		{name: "Valid", modify: func(cmi *ChargeManagementInfo) {}},
+		{name: "Charge voltage too high", modify: func(cmi *ChargeManagementInfo) { cmi.ChargeVoltageLimit = 54.5 }, wantErr: true},
+		{name: "Discharge voltage too low", modify: func(cmi *ChargeManagementInfo) { cmi.DischargeVoltageLimit = 43 }, wantErr: true, wantMsg: "minimum 44.000V"},
+		{name: "Discharge above charge voltage", modify: func(cmi *ChargeManagementInfo) { cmi.DischargeVoltageLimit = 53.5 }, wantErr: true, wantMsg: "must be below charge voltage limit"},
+		{name: "Charge current too high", modify: func(cmi *ChargeManagementInfo) { cmi.ChargeCurrentLimit = 40 }, wantErr: true},
+		{name: "Discharge current positive", modify: func(cmi *ChargeManagementInfo) { cmi.DischargeCurrentLimit = 10 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmi := valid
+			tt.modify(&cmi)
+			err := cmi.Validate(sp)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrOutOfRange)) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.wantMsg)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func Test_parseSerialNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "Full length", info: append([]byte{1}, "PPTAP01234567801"...), want: "PPTAP01234567801"},
+		{name: "Padded", info: append([]byte{2}, "HBTBP0123456\x00\x00\x00\x00"...), want: "HBTBP0123456"},
+		{name: "Empty", info: []byte{1}, wantErr: true},
+		{name: "Padding only", info: append([]byte{1}, "\x00\x00  \x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"...), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSerialNumber(tt.info)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSerialNumber() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseSerialNumber() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseBatteryGroupStatusMalformed(t *testing.T) {
+	// One pack with 2 cells and 1 temperature sensor, followed by the
+	// user defined fields
+	pack := []byte{0x00, 0x01, 0x02, 0x0D, 0x05, 0x0D, 0x06, 0x01, 0x0B, 0xB9, 0x00, 0x64, 0x1A, 0x0A, 0x61, 0xA8}
+
+	tests := []struct {
+		name        string
+		info        []byte
+		wantErr     error
+		wantCycles  int
+		wantTotal   float32
+		wantVoltage float32
+	}{
+		{name: "Standard", info: append(pack[:16:16], 0x02, 0xC3, 0x50, 0x00, 0x07), wantCycles: 7, wantTotal: 50, wantVoltage: 6.666},
+		{name: "Extra user defined fields", info: append(pack[:16:16], 0x06, 0xFF, 0xFF, 0x00, 0x07, 0x00, 0x61, 0xA8, 0x01, 0x21, 0x10, 0x12, 0x34, 0x56, 0x78), wantCycles: 7, wantTotal: 74, wantVoltage: 6.666},
+		{name: "No user defined fields", info: append(pack[:16:16], 0x00), wantVoltage: 6.666},
+		{name: "Empty", info: nil, wantErr: ErrShortResponse},
+		{name: "Truncated cells", info: pack[:5], wantErr: ErrShortResponse},
+		{name: "Truncated capacity", info: append(pack[:16:16], 0x04, 0xFF, 0xFF, 0x00, 0x07, 0x00, 0x61), wantErr: ErrShortResponse},
+		{name: "Missing pack", info: []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, wantErr: ErrShortResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBatteryGroupStatus(tt.info)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseBatteryGroupStatus() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			bs := got.Status[0]
+			if bs.Cycles != tt.wantCycles || math.Abs(float64(bs.TotalCapacity-tt.wantTotal)) > 0.001 || math.Abs(float64(bs.TotalVoltage-tt.wantVoltage)) > 0.001 {
+				t.Errorf("parseBatteryGroupStatus() got = %+v", bs)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameMalformed(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  error
+	}{
+		{name: "Empty", response: "", wantErr: ErrFraming},
+		{name: "Invalid hex in header", response: "~2001460G0000FD9C\r", wantErr: ErrFraming},
+		{name: "Invalid hex in info", response: "~20014600E002ZZFCE8\r", wantErr: ErrFraming},
+		{name: "Odd info length", response: "~20014600F0010FD6C\r", wantErr: ErrFraming},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeFrame([]byte(tt.response))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeFrame() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Every response, however malformed, has to be rejected with an error
+// instead of crashing the caller.
+func FuzzDecodeFrame(f *testing.F) {
+	f.Add([]byte("~200146000000FDB3\r"))
+	f.Add([]byte("~20014600C0405553324B42504C000000020150796C6F6E2D2D2D2D2D2D2D2D2D2D2D2D2D2D2DEF9B\r"))
+	f.Add([]byte("~2001460010F011020F0D1A0D220D220D200D1D0D210D1D0D190D1A0D1E0D210D1F0D1C0D1A0D1C050BB90BB90BB90BC30BB900BEC4BCFFFF04FFFF010A00BEC80121100F0D220D230D1F0D1C0D1C0D1C0D1C0D1A0D1C0D1D0D1D0D1C0D1C0D1C0D1D050BC30BB90BB90BB90BB900BDC4B5FFFF04FFFF010600B900012110C7D3\r"))
+	f.Add([]byte("~20014600C04000011000000200000000000000000000000000040000F000000000020E800400F15B\r"))
+	f.Add([]byte("~20014600B032110E420BB80AF00C9F0AAB2710CD14BB80AFC80CD109E3C568F253\r"))
+
+	f.Fuzz(func(t *testing.T, response []byte) {
+		decoded, err := DecodeFrame(response)
+		if err != nil {
+			return
+		}
+		fuzzParsers(decoded.Info)
+	})
+}
+
+func FuzzParseInfo(f *testing.F) {
+	f.Add([]byte{0x00, 0x01, 0x02, 0x0D, 0x05, 0x0D, 0x06, 0x01, 0x0B, 0xB9, 0x00, 0x64, 0x1A, 0x0A, 0x61, 0xA8, 0x02, 0xC3, 0x50, 0x00, 0x07})
+	f.Add([]byte{0x00, 0x01, 0x02, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	f.Add([]byte{0x02, 'P', 'P', 'T', 'A', 'P'})
+
+	f.Fuzz(func(t *testing.T, info []byte) {
+		fuzzParsers(info)
+	})
+}
+
+func fuzzParsers(info []byte) {
+	parseManufacturerInfo(info)
+	parseBatteryGroupStatus(info)
+	parseAlarmGroupInfo(info)
+	parseSystemParameters(info)
+	parseChargeManagementInfo(info)
+	parseSerialNumber(info)
+}
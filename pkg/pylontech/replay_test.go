@@ -0,0 +1,47 @@
+package pylontech
+
+import (
+	"math"
+	"testing"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+func TestGetBatteryStatusReplay(t *testing.T) {
+	c, err := connector.NewReplayConnector("testdata/session-us3000.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := GetProtocolVersion(c)
+	if err != nil {
+		t.Fatalf("GetProtocolVersion() error = %v", err)
+	}
+	if version != "20" {
+		t.Errorf("GetProtocolVersion() got = %v, want 20", version)
+	}
+
+	got, err := GetBatteryStatus(c)
+	if err != nil {
+		t.Fatalf("GetBatteryStatus() error = %v", err)
+	}
+	if got.Count != 2 || len(got.Status) != 2 {
+		t.Fatalf("GetBatteryStatus() got %d packs, want 2", len(got.Status))
+	}
+	if math.Abs(float64(74.0-got.Status[1].TotalCapacity)) > 0.01 {
+		t.Errorf("GetBatteryStatus() total capacity got = %v, want 74", got.Status[1].TotalCapacity)
+	}
+
+	alarms, err := GetAlarmInfo(c)
+	if err != nil {
+		t.Fatalf("GetAlarmInfo() error = %v", err)
+	}
+	if len(alarms.Alarms) != 2 || alarms.Alarms[0].HasAlarm() || !alarms.Alarms[1].ChargeMOSFETOn {
+		t.Errorf("GetAlarmInfo() got = %+v", alarms)
+	}
+
+	serialNumber, err := GetSerialNumber(c, 2)
+	if err != nil || serialNumber != "PPTAP01234567802" {
+		t.Errorf("GetSerialNumber() got = %v, %v", serialNumber, err)
+	}
+}
@@ -0,0 +1,51 @@
+package pylontech
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// Returns the addresses from first to last that answer a protocol version
+// request within timeout, i.e. the battery groups on the bus.
+func Scan(c connector.Connector, first byte, last byte, timeout time.Duration) ([]byte, error) {
+	return ScanContext(context.Background(), c, first, last, timeout)
+}
+
+func ScanContext(ctx context.Context, c connector.Connector, first byte, last byte, timeout time.Duration) ([]byte, error) {
+	var addresses []byte
+	for address := int(first); address <= int(last); address++ {
+		found, err := probe(ctx, c, byte(address), timeout)
+		if err != nil {
+			return addresses, err
+		}
+		if found {
+			addresses = append(addresses, byte(address))
+		}
+	}
+	return addresses, nil
+}
+
+// Returns true if a device answers at address. Garbled responses, e.g. from
+// collisions on the bus, and timeouts count as no answer, a battery
+// reporting an error does answer.
+func probe(ctx context.Context, c connector.Connector, address byte, timeout time.Duration) (bool, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := GetProtocolVersionAtContext(probeCtx, c, address)
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var respErr *ResponseError
+	switch {
+	case err == nil, errors.As(err, &respErr):
+		return true, nil
+	case errors.Is(err, ErrTimeout), errors.Is(err, ErrChecksum), errors.Is(err, ErrFraming):
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,343 @@
+package pylontech
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// SimulatorPack is the state of a single simulated battery pack.
+type SimulatorPack struct {
+	SerialNumber string
+	Status       BatteryStatus
+	Alarms       AlarmInfo
+	// Limits recommended by the BMS, changed by CmdSetChargeManagementInfo
+	ChargeManagement ChargeManagementInfo
+	// Set once turned off by a CmdTurnOff request
+	Off bool
+	// Encodes capacities with 3 bytes, as packs above 65Ah do, instead of 2
+	ExtendedCapacity bool
+}
+
+// Returns a pack with cellCount cells at 3.3V, tempCount sensors at 25°C and
+// the given capacity in Ah, half charged.
+func NewSimulatorPack(serialNumber string, cellCount int, tempCount int, capacity float32) SimulatorPack {
+	status := BatteryStatus{
+		CellCount:         cellCount,
+		TempCount:         tempCount,
+		TotalVoltage:      3.3 * float32(cellCount),
+		RemainingCapacity: capacity / 2,
+		TotalCapacity:     capacity,
+		Cycles:            10,
+	}
+	for i := 0; i < cellCount; i++ {
+		status.CellVoltage = append(status.CellVoltage, 3.3)
+	}
+	for i := 0; i < tempCount; i++ {
+		status.Temperature = append(status.Temperature, 25)
+	}
+
+	alarms := AlarmInfo{
+		CellCount:         cellCount,
+		CellVoltage:       make([]AlarmState, cellCount),
+		TempCount:         tempCount,
+		Temperature:       make([]AlarmState, tempCount),
+		DischargeMOSFETOn: true,
+		ChargeMOSFETOn:    true,
+		CellError:         make([]bool, cellCount),
+	}
+
+	// Charge voltage 53.2V, discharge voltage 44.5V, charge and discharge
+	// current 37A, charging and discharging enabled
+	charge := ChargeManagementInfo{
+		ChargeVoltageLimit:    53.2,
+		DischargeVoltageLimit: 44.5,
+		ChargeCurrentLimit:    37,
+		DischargeCurrentLimit: -37,
+		ChargeEnabled:         true,
+		DischargeEnabled:      true,
+	}
+
+	return SimulatorPack{
+		SerialNumber:     serialNumber,
+		Status:           status,
+		Alarms:           alarms,
+		ChargeManagement: charge,
+		ExtendedCapacity: capacity > math.MaxUint16/1000,
+	}
+}
+
+// Simulator is a virtual stack of Pylontech packs answering on a single
+// address, like the master pack of a battery group.
+type Simulator struct {
+	mu         sync.Mutex
+	address    byte
+	packs      []SimulatorPack
+	parameters SystemParameters
+}
+
+// Returns a simulator for the given packs at address 1, or for two US3000C
+// packs if none are given.
+func NewSimulator(packs ...SimulatorPack) *Simulator {
+	if len(packs) == 0 {
+		packs = []SimulatorPack{
+			NewSimulatorPack("PPTAP01234567801", 15, 5, 74),
+			NewSimulatorPack("PPTAP01234567802", 15, 5, 74),
+		}
+	}
+	return &Simulator{address: 1, packs: packs, parameters: simSystemParameters}
+}
+
+// Returns an in-memory connector to the simulator.
+func (s *Simulator) Connector() *connector.ResponderConnector {
+	return connector.NewResponderConnector(s)
+}
+
+func (s *Simulator) Address() byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.address
+}
+
+// Sets the address the simulator answers on, to simulate further battery
+// groups on the same bus.
+func (s *Simulator) SetAddress(address byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.address = address
+}
+
+// Returns pack number n, counting from 1 as the protocol does.
+func (s *Simulator) Pack(n int) SimulatorPack {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.packs[n-1]
+}
+
+func (s *Simulator) SetPack(n int, pack SimulatorPack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packs[n-1] = pack
+}
+
+func (s *Simulator) SystemParameters() SystemParameters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.parameters
+}
+
+func (s *Simulator) SetSystemParameters(parameters SystemParameters) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parameters = parameters
+}
+
+// Answers a single request frame, see connector.Responder. Requests for
+// other addresses are left unanswered, as other devices on the bus would
+// answer them.
+func (s *Simulator) Respond(request []byte) []byte {
+	req, err := DecodeFrame(request)
+	if err != nil {
+		return s.response(rtnChecksumError, nil)
+	}
+	if req.Address != s.address {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.CID2 {
+	case CmdGetProtocolVersion:
+		return s.response(rtnNormal, nil)
+	case CmdGetManufacturerInfo:
+		return s.response(rtnNormal, simManufacturerInfo())
+	case CmdGetBatteryStatus:
+		return s.packResponse(req.Info, true, encodeSimBatteryStatus)
+	case CmdGetAlarmData:
+		return s.packResponse(req.Info, true, encodeSimAlarmData)
+	case CmdGetSystemParameter:
+		return s.response(rtnNormal, encodeSimSystemParameters(&s.parameters))
+	case CmdGetChargeManagementInfo:
+		return s.packResponse(req.Info, false, encodeSimChargeManagementInfo)
+	case CmdSetChargeManagementInfo:
+		return s.setChargeManagementInfo(req.Info)
+	case CmdGetSeriesNumber:
+		return s.packResponse(req.Info, false, encodeSimSeriesNumber)
+	case CmdTurnOff:
+		return s.packResponse(req.Info, false, func(_ int, pack *SimulatorPack) []byte {
+			pack.Off = true
+			return nil
+		})
+	}
+
+	return s.response(rtnCID2Invalid, nil)
+}
+
+// Answers a request for the pack in info, or for all packs if allowAll is
+// set and info holds AllBatteries.
+func (s *Simulator) packResponse(info []byte, allowAll bool, encode func(n int, pack *SimulatorPack) []byte) []byte {
+	if len(info) != 1 {
+		return s.response(rtnInvalidData, nil)
+	}
+
+	n := int(info[0])
+	if n == AllBatteries && allowAll {
+		resp := []byte{0, byte(len(s.packs))}
+		for i := range s.packs {
+			resp = append(resp, encode(i+1, &s.packs[i])...)
+		}
+		return s.response(rtnNormal, resp)
+	}
+	if n < 1 || n > len(s.packs) {
+		return s.response(rtnInvalidData, nil)
+	}
+
+	resp := encode(n, &s.packs[n-1])
+	if allowAll {
+		resp = append([]byte{0, byte(n)}, resp...)
+	}
+	return s.response(rtnNormal, resp)
+}
+
+func (s *Simulator) response(rtn Command, info []byte) []byte {
+	encoded, err := NewFrame(s.address, rtn, info).Encode()
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+func simManufacturerInfo() []byte {
+	info := make([]byte, 0, 32)
+	info = append(info, "US3000C\x00\x00\x00"...)
+	info = append(info, 2, 1)
+	info = append(info, "Pylon---------------"...)
+	return info
+}
+
+func encodeSimBatteryStatus(_ int, pack *SimulatorPack) []byte {
+	bs := &pack.Status
+	info := []byte{byte(bs.CellCount)}
+	for _, v := range bs.CellVoltage {
+		info = binary.BigEndian.AppendUint16(info, uint16(math.Round(float64(v)*1000)))
+	}
+	info = append(info, byte(bs.TempCount))
+	for _, t := range bs.Temperature {
+		info = binary.BigEndian.AppendUint16(info, uint16(int16(math.Round(float64(t)*10))+celsiusScale))
+	}
+	info = binary.BigEndian.AppendUint16(info, uint16(int16(math.Round(float64(bs.Current)*100))))
+	info = binary.BigEndian.AppendUint16(info, uint16(math.Round(float64(bs.TotalVoltage)*1000)))
+
+	remaining := uint32(math.Round(float64(bs.RemainingCapacity) * 1000))
+	total := uint32(math.Round(float64(bs.TotalCapacity) * 1000))
+	if !pack.ExtendedCapacity {
+		info = binary.BigEndian.AppendUint16(info, uint16(remaining))
+		info = append(info, 2)
+		info = binary.BigEndian.AppendUint16(info, uint16(total))
+		info = binary.BigEndian.AppendUint16(info, uint16(bs.Cycles))
+		return info
+	}
+
+	info = binary.BigEndian.AppendUint16(info, 0xFFFF)
+	info = append(info, 4)
+	info = binary.BigEndian.AppendUint16(info, 0xFFFF)
+	info = binary.BigEndian.AppendUint16(info, uint16(bs.Cycles))
+	info = append(info, byte(remaining>>16), byte(remaining>>8), byte(remaining))
+	info = append(info, byte(total>>16), byte(total>>8), byte(total))
+	return info
+}
+
+func encodeSimAlarmData(_ int, pack *SimulatorPack) []byte {
+	a := &pack.Alarms
+	info := []byte{byte(a.CellCount)}
+	for _, state := range a.CellVoltage {
+		info = append(info, byte(state))
+	}
+	info = append(info, byte(a.TempCount))
+	for _, state := range a.Temperature {
+		info = append(info, byte(state))
+	}
+	info = append(info, byte(a.ChargeCurrent), byte(a.ModuleVoltage), byte(a.DischargeCurrent))
+
+	var status [5]byte
+	status[0] = bits(a.ModuleOverVoltage, a.CellUnderVoltage, a.ChargeOverCurrent, false,
+		a.DischargeOverCurrent, a.DischargeOverTemperature, a.ChargeOverTemperature, a.ModuleUnderVoltage)
+	status[1] = bits(a.PreMOSFETOn, a.ChargeMOSFETOn, a.DischargeMOSFETOn, a.UsingBatteryPower)
+	status[2] = bits(a.BuzzerOn, false, false, a.FullyCharged, false, a.HeaterOn, a.DischargeCurrentEffective, a.ChargeCurrentEffective)
+	for i, cellError := range a.CellError {
+		if cellError && i < 16 {
+			status[3+i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(info, status[:]...)
+}
+
+// Limits of a US3000C.
+var simSystemParameters = SystemParameters{
+	CellHighVoltageLimit:          3.7,
+	CellLowVoltageLimit:           3.05,
+	CellUnderVoltageLimit:         2.9,
+	ChargeHighTemperatureLimit:    60,
+	ChargeLowTemperatureLimit:     0,
+	ChargeCurrentLimit:            102,
+	ModuleHighVoltageLimit:        54,
+	ModuleLowVoltageLimit:         46,
+	ModuleUnderVoltageLimit:       44,
+	DischargeHighTemperatureLimit: 60,
+	DischargeLowTemperatureLimit:  -10,
+	DischargeCurrentLimit:         -102,
+}
+
+func encodeSimSystemParameters(sp *SystemParameters) []byte {
+	millivolts := func(v float32) uint16 { return uint16(math.Round(float64(v) * 1000)) }
+	deciKelvin := func(t float32) uint16 { return uint16(int16(math.Round(float64(t)*10)) + celsiusScale) }
+	centiAmps := func(a float32) uint16 { return uint16(int16(math.Round(float64(a) * 100))) }
+
+	info := []byte{sp.FlagData}
+	for _, v := range []uint16{
+		millivolts(sp.CellHighVoltageLimit),
+		millivolts(sp.CellLowVoltageLimit),
+		millivolts(sp.CellUnderVoltageLimit),
+		deciKelvin(sp.ChargeHighTemperatureLimit),
+		deciKelvin(sp.ChargeLowTemperatureLimit),
+		centiAmps(sp.ChargeCurrentLimit),
+		millivolts(sp.ModuleHighVoltageLimit),
+		millivolts(sp.ModuleLowVoltageLimit),
+		millivolts(sp.ModuleUnderVoltageLimit),
+		deciKelvin(sp.DischargeHighTemperatureLimit),
+		deciKelvin(sp.DischargeLowTemperatureLimit),
+		centiAmps(sp.DischargeCurrentLimit),
+	} {
+		info = binary.BigEndian.AppendUint16(info, v)
+	}
+	return info
+}
+
+func encodeSimChargeManagementInfo(n int, pack *SimulatorPack) []byte {
+	return encodeChargeManagementInfo(byte(n), &pack.ChargeManagement)
+}
+
+// Stores the limits for a pack, rejecting them as invalid data if they
+// exceed the system parameters.
+func (s *Simulator) setChargeManagementInfo(info []byte) []byte {
+	cmi, err := parseChargeManagementInfo(info)
+	if err != nil || len(info) != 10 {
+		return s.response(rtnCommandFormatError, nil)
+	}
+	n := int(info[0])
+	if n < 1 || n > len(s.packs) || cmi.Validate(&s.parameters) != nil {
+		return s.response(rtnInvalidData, nil)
+	}
+
+	s.packs[n-1].ChargeManagement = *cmi
+	return s.response(rtnNormal, nil)
+}
+
+func encodeSimSeriesNumber(n int, pack *SimulatorPack) []byte {
+	serial := make([]byte, 16)
+	copy(serial, pack.SerialNumber)
+	return append([]byte{byte(n)}, serial...)
+}
@@ -0,0 +1,37 @@
+package pylontech
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/goburrow/serial"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+func TestSimulatorPTY(t *testing.T) {
+	pty, err := connector.OpenPTY()
+	if err != nil {
+		t.Skip("no pseudo-terminal available: ", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go connector.Serve(ctx, pty, end, NewSimulator())
+
+	sc := connector.NewSerialConnector(serial.Config{Address: pty.Path, BaudRate: 1200, Timeout: time.Second})
+	err = sc.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	got, err := GetBatteryStatus(sc)
+	if err != nil {
+		t.Fatalf("GetBatteryStatus() error = %v", err)
+	}
+	if got.Count != 2 || got.Status[1].TotalCapacity != 74 {
+		t.Errorf("GetBatteryStatus() got = %+v", got)
+	}
+}
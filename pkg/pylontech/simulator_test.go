@@ -0,0 +1,179 @@
+package pylontech
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+func TestSimulator(t *testing.T) {
+	small := NewSimulatorPack("PPTBH02100000001", 16, 4, 50)
+	small.Status.Current = -12.5
+	small.Status.Temperature[1] = -3.5
+	large := NewSimulatorPack("PPTAP01234567802", 15, 5, 74)
+	sim := NewSimulator(small, large)
+	c := sim.Connector()
+
+	version, err := GetProtocolVersion(c)
+	if err != nil || version != "20" {
+		t.Errorf("GetProtocolVersion() got = %v, %v", version, err)
+	}
+
+	info, err := GetManufacturerInfo(c)
+	if err != nil || info.DeviceName != "US3000C" || info.ManufacturerName != "Pylon---------------" {
+		t.Errorf("GetManufacturerInfo() got = %v, %v", info, err)
+	}
+
+	got, err := GetBatteryStatus(c)
+	if err != nil {
+		t.Fatalf("GetBatteryStatus() error = %v", err)
+	}
+	if got.Count != 2 {
+		t.Fatalf("GetBatteryStatus() got %d packs, want 2", got.Count)
+	}
+	for i, want := range []BatteryStatus{small.Status, large.Status} {
+		if !reflect.DeepEqual(got.Status[i], want) {
+			t.Errorf("GetBatteryStatus() pack %d got = %+v, want %+v", i+1, got.Status[i], want)
+		}
+	}
+
+	large.Alarms.CellVoltage[4] = AlarmBelowLowerLimit
+	large.Alarms.CellUnderVoltage = true
+	large.Alarms.CellError[4] = true
+	large.Alarms.HeaterOn = true
+	sim.SetPack(2, large)
+	alarms, err := GetAlarmInfo(c)
+	if err != nil {
+		t.Fatalf("GetAlarmInfo() error = %v", err)
+	}
+	for i, want := range []AlarmInfo{small.Alarms, large.Alarms} {
+		if !reflect.DeepEqual(alarms.Alarms[i], want) {
+			t.Errorf("GetAlarmInfo() pack %d got = %+v, want %+v", i+1, alarms.Alarms[i], want)
+		}
+	}
+	if alarms.Alarms[0].HasAlarm() || !alarms.Alarms[1].HasAlarm() {
+		t.Error("HasAlarm() want alarm on pack 2 only")
+	}
+
+	params, err := GetSystemParameters(c)
+	if err != nil {
+		t.Fatalf("GetSystemParameters() error = %v", err)
+	}
+	if *params != sim.SystemParameters() {
+		t.Errorf("GetSystemParameters() got = %+v, want %+v", *params, sim.SystemParameters())
+	}
+
+	charge, err := GetChargeManagementInfo(c, 2)
+	if err != nil || *charge != large.ChargeManagement {
+		t.Errorf("GetChargeManagementInfo() got = %+v, %v", charge, err)
+	}
+	charge.ChargeCurrentLimit = 25
+	charge.FullChargeRequest = true
+	err = SetChargeManagementInfo(c, 2, charge)
+	if err != nil {
+		t.Fatalf("SetChargeManagementInfo() error = %v", err)
+	}
+	if got := sim.Pack(2).ChargeManagement; got != *charge {
+		t.Errorf("SetChargeManagementInfo() pack got = %+v, want %+v", got, *charge)
+	}
+	charge.ChargeVoltageLimit = 60
+	err = SetChargeManagementInfo(c, 2, charge)
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("SetChargeManagementInfo() error = %v, want %v", err, ErrOutOfRange)
+	}
+
+	identity, err := GetPackIdentity(c, 1)
+	if err != nil {
+		t.Fatalf("GetPackIdentity() error = %v", err)
+	}
+	if identity.SerialNumber != "PPTBH02100000001" || identity.ManufacturerInfo.DeviceName != "US3000C" || identity.ProtocolVersion != "20" {
+		t.Errorf("GetPackIdentity() got = %+v", identity)
+	}
+
+	err = TurnOff(c, 2, "PPTAP01234567801")
+	if !errors.Is(err, ErrNotConfirmed) || sim.Pack(2).Off {
+		t.Errorf("TurnOff() error = %v, want %v", err, ErrNotConfirmed)
+	}
+	err = TurnOff(c, 2, "PPTAP01234567802")
+	if err != nil || !sim.Pack(2).Off || sim.Pack(1).Off {
+		t.Errorf("TurnOff() error = %v, pack 2 off %v", err, sim.Pack(2).Off)
+	}
+}
+
+func TestSimulatorRequests(t *testing.T) {
+	sim := NewSimulator()
+
+	tests := []struct {
+		name    string
+		request []byte
+		wantRTN Command
+		wantLen int
+	}{
+		{name: "Alarm data", request: mustEncode(t, NewFrame(1, CmdGetAlarmData, []byte{2})), wantRTN: rtnNormal, wantLen: 2 + 1 + 15 + 1 + 5 + 3 + 5},
+		{name: "System parameters", request: mustEncode(t, NewFrame(1, CmdGetSystemParameter, nil)), wantRTN: rtnNormal, wantLen: 25},
+		{name: "Charge management", request: mustEncode(t, NewFrame(1, CmdGetChargeManagementInfo, []byte{1})), wantRTN: rtnNormal, wantLen: 10},
+		{name: "Set charge management", request: mustEncode(t, NewFrame(1, CmdSetChargeManagementInfo, encodeChargeManagementInfo(1, &ChargeManagementInfo{ChargeVoltageLimit: 52, DischargeVoltageLimit: 47, ChargeCurrentLimit: 20, DischargeCurrentLimit: -20}))), wantRTN: rtnNormal},
+		{name: "Set charge management above limits", request: mustEncode(t, NewFrame(1, CmdSetChargeManagementInfo, encodeChargeManagementInfo(1, &ChargeManagementInfo{ChargeVoltageLimit: 52, DischargeVoltageLimit: 47, ChargeCurrentLimit: 200}))), wantRTN: rtnInvalidData},
+		{name: "Serial number", request: mustEncode(t, NewFrame(1, CmdGetSeriesNumber, []byte{2})), wantRTN: rtnNormal, wantLen: 17},
+		{name: "Missing pack", request: mustEncode(t, NewFrame(1, CmdGetSeriesNumber, []byte{3})), wantRTN: rtnInvalidData},
+		{name: "Unknown command", request: mustEncode(t, NewFrame(1, Command(0x99), nil)), wantRTN: rtnCID2Invalid},
+		{name: "Bad checksum", request: []byte("~2001464F0000FD98\r"), wantRTN: rtnChecksumError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := DecodeFrame(sim.Respond(tt.request))
+			if err != nil {
+				t.Fatalf("DecodeFrame() error = %v", err)
+			}
+			if resp.CID2 != tt.wantRTN || len(resp.Info) != tt.wantLen {
+				t.Errorf("Respond() got RTN %02X with %d bytes, want %02X with %d", byte(resp.CID2), len(resp.Info), byte(tt.wantRTN), tt.wantLen)
+			}
+		})
+	}
+
+	if resp := sim.Respond(mustEncode(t, NewFrame(2, CmdGetProtocolVersion, nil))); resp != nil {
+		t.Errorf("Respond() got = %q for another address, want no response", resp)
+	}
+}
+
+func mustEncode(t *testing.T, f *Frame) []byte {
+	t.Helper()
+	encoded, err := f.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestScan(t *testing.T) {
+	first := NewSimulator()
+	second := NewSimulator(NewSimulatorPack("PPTAP01234567803", 16, 4, 50))
+	second.SetAddress(3)
+	c := connector.NewResponderConnector(connector.ResponderFunc(func(request []byte) []byte {
+		if resp := first.Respond(request); resp != nil {
+			return resp
+		}
+		return second.Respond(request)
+	}))
+
+	addresses, err := Scan(c, 1, 8, time.Second)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if !bytes.Equal(addresses, []byte{1, 3}) {
+		t.Errorf("Scan() got = %v, want [1 3]", addresses)
+	}
+
+	got, err := GetBatteryStatusAt(c, 3)
+	if err != nil || got.Count != 1 || got.Status[0].CellCount != 16 {
+		t.Errorf("GetBatteryStatusAt() got = %+v, %v", got, err)
+	}
+	serialNumber, err := GetSerialNumberAt(c, 3, 1)
+	if err != nil || serialNumber != "PPTAP01234567803" {
+		t.Errorf("GetSerialNumberAt() got = %v, %v", serialNumber, err)
+	}
+}
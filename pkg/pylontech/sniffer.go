@@ -0,0 +1,130 @@
+package pylontech
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/marevers/energia/pkg/connector"
+)
+
+// SnifferEvent is a single frame seen on the bus.
+type SnifferEvent struct {
+	Time time.Time
+	// The frame as read, without the terminating CR
+	Raw []byte
+	// Nil if the frame could not be decoded, see Err
+	Frame    *Frame
+	Response bool
+	// The command of a request, or of the request a response answers. Zero
+	// for responses that do not follow a request to the same address.
+	Command Command
+	// Return code of a response
+	Code byte
+	// Payload of a normal response to a known command, e.g. a
+	// *BatteryGroupStatus for CmdGetBatteryStatus
+	Data any
+	Err  error
+}
+
+// Sniffer passively decodes the traffic between another master, e.g. the
+// BMS port of an inverter, and the batteries on a shared RS485 line. It
+// never writes to the bus.
+type Sniffer struct {
+	c       connector.Connector
+	request *Frame
+}
+
+func NewSniffer(c connector.Connector) *Sniffer {
+	return &Sniffer{c: c}
+}
+
+// Reads and decodes the next frame. Frames that cannot be decoded are
+// returned as an event with Err set, an error is only returned if reading
+// fails.
+func (s *Sniffer) Next(ctx context.Context) (*SnifferEvent, error) {
+	data, err := connector.ReadContext(ctx, s.c, end)
+	if err != nil {
+		return nil, err
+	}
+	// Resynchronise on the last start of frame, e.g. after joining the bus
+	// mid-frame
+	if i := bytes.LastIndexByte(data, start); i > 0 {
+		data = data[i:]
+	}
+
+	ev := &SnifferEvent{Time: time.Now(), Raw: bytes.TrimSuffix(data, []byte{end})}
+	ev.Frame, ev.Err = DecodeFrame(data)
+	if ev.Err != nil {
+		return ev, nil
+	}
+
+	f := ev.Frame
+	if !isReturnCode(f.CID2) {
+		ev.Command = f.CID2
+		s.request = f
+		return ev, nil
+	}
+
+	ev.Response = true
+	ev.Code = byte(f.CID2)
+	if s.request == nil || s.request.Address != f.Address {
+		return ev, nil
+	}
+	ev.Command = s.request.CID2
+	s.request = nil
+	if f.CID2 == rtnNormal {
+		ev.Data, ev.Err = decodeInfo(ev.Command, f.Info)
+	} else {
+		ev.Err = &ResponseError{Code: ev.Code}
+	}
+	return ev, nil
+}
+
+// Passes every frame to handle until ctx is done or reading fails. Read
+// timeouts are expected while the bus is idle and are ignored.
+func (s *Sniffer) Run(ctx context.Context, handle func(*SnifferEvent)) error {
+	for {
+		ev, err := s.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, ErrTimeout) {
+				continue
+			}
+			return err
+		}
+		handle(ev)
+	}
+}
+
+// Return codes never overlap with commands, which start at 0x40.
+func isReturnCode(cid2 Command) bool {
+	if cid2 == rtnNormal {
+		return true
+	}
+	_, ok := rtnDescriptions[byte(cid2)]
+	return ok
+}
+
+// Decodes the payload of a normal response to command, nil for commands
+// without or with an unknown payload.
+func decodeInfo(command Command, info []byte) (any, error) {
+	switch command {
+	case CmdGetBatteryStatus:
+		return parseBatteryGroupStatus(info)
+	case CmdGetAlarmData:
+		return parseAlarmGroupInfo(info)
+	case CmdGetSystemParameter:
+		return parseSystemParameters(info)
+	case CmdGetManufacturerInfo:
+		return parseManufacturerInfo(info)
+	case CmdGetChargeManagementInfo:
+		return parseChargeManagementInfo(info)
+	case CmdGetSeriesNumber:
+		return parseSerialNumber(info)
+	}
+	return nil, nil
+}
@@ -0,0 +1,74 @@
+package pylontech
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Replays the frames seen on a bus, one per read.
+type busConnector struct {
+	frames [][]byte
+}
+
+func (b *busConnector) Open() error { return nil }
+
+func (b *busConnector) Close() {}
+
+func (b *busConnector) ReadUntilCR() ([]byte, error) { return b.Read(end) }
+
+func (b *busConnector) Read(terminator byte) ([]byte, error) {
+	if len(b.frames) == 0 {
+		return nil, io.EOF
+	}
+	f := b.frames[0]
+	b.frames = b.frames[1:]
+	return f, nil
+}
+
+func (b *busConnector) Write(bytes []byte) error { return errors.New("sniffing only") }
+
+func TestSniffer(t *testing.T) {
+	sim := NewSimulator()
+	status := mustEncode(t, NewFrame(1, CmdGetBatteryStatus, []byte{AllBatteries}))
+	serial := mustEncode(t, NewFrame(1, CmdGetSeriesNumber, []byte{2}))
+	unknown := mustEncode(t, NewFrame(1, Command(0x61), nil))
+
+	bus := &busConnector{frames: [][]byte{
+		append([]byte{0x00, 0x55}, status...),
+		sim.Respond(status),
+		serial,
+		sim.Respond(serial),
+		unknown,
+		sim.Respond(unknown),
+		[]byte("~2001464F0000FD98\r"),
+	}}
+
+	var events []*SnifferEvent
+	err := NewSniffer(bus).Run(context.Background(), func(ev *SnifferEvent) {
+		events = append(events, ev)
+	})
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Run() error = %v, want EOF", err)
+	}
+	if len(events) != 7 {
+		t.Fatalf("Run() got %d events, want 7", len(events))
+	}
+
+	if ev := events[0]; ev.Err != nil || ev.Response || ev.Command != CmdGetBatteryStatus || ev.Frame.Address != 1 {
+		t.Errorf("request event = %+v", ev)
+	}
+	if bgs, ok := events[1].Data.(*BatteryGroupStatus); !ok || !events[1].Response || events[1].Command != CmdGetBatteryStatus || bgs.Count != 2 {
+		t.Errorf("battery status response event = %+v", events[1])
+	}
+	if serialNumber, ok := events[3].Data.(string); !ok || serialNumber != "PPTAP01234567802" {
+		t.Errorf("serial number response event = %+v", events[3])
+	}
+	if ev := events[5]; !ev.Response || ev.Command.Name() != "0x61" || !errors.Is(ev.Err, ErrNotSupported) {
+		t.Errorf("unknown command response event = %+v", ev)
+	}
+	if ev := events[6]; ev.Frame != nil || !errors.Is(ev.Err, ErrChecksum) {
+		t.Errorf("corrupt frame event = %+v", ev)
+	}
+}
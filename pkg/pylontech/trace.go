@@ -0,0 +1,48 @@
+package pylontech
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Describes the framing of a request or response for tracing, see
+// connector.FrameDecoder. In responses cid2 holds the return code rather
+// than a command.
+func DescribeFrame(data []byte) string {
+	dataLen := len(data)
+	if dataLen < 18 || data[0] != start || data[dataLen-1] != end {
+		return "incomplete frame"
+	}
+
+	frameData := data[1 : dataLen-5]
+	var sb strings.Builder
+
+	cid2, _ := hex2Byte(frameData[6:8])
+	fmt.Fprintf(&sb, "ver=%s adr=%s cid1=%s cid2=%s", frameData[0:2], frameData[2:4], frameData[4:6], frameData[6:8])
+	if name, ok := commandNames[Command(cid2)]; ok {
+		fmt.Fprintf(&sb, " (%s)", name)
+	}
+
+	info := frameData[12:]
+	lenID, err := strconv.ParseUint(string(frameData[8:12]), 16, 16)
+	lenCheck, _ := lengthChecksum(len(info))
+	switch {
+	case err != nil:
+		fmt.Fprintf(&sb, " length=%s invalid", frameData[8:12])
+	case uint16(lenID) != lenCheck:
+		fmt.Fprintf(&sb, " length=%04X mismatch, expected %04X", lenID, lenCheck)
+	default:
+		fmt.Fprintf(&sb, " length=%d ok", len(info))
+	}
+
+	checkSum := data[dataLen-5 : dataLen-1]
+	calcSum, _ := frameChecksum(string(frameData))
+	if parsed, err := strconv.ParseUint(string(checkSum), 16, 16); err != nil || uint16(parsed) != calcSum {
+		fmt.Fprintf(&sb, " chksum=%s mismatch, expected %04X", checkSum, calcSum)
+	} else {
+		fmt.Fprintf(&sb, " chksum=%s ok", checkSum)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,24 @@
+package pylontech
+
+import "testing"
+
+func TestDescribeFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "Request", data: "~2001464F0000FD99\r", want: "ver=20 adr=01 cid1=46 cid2=4F (getProtocolVersion) length=0 ok chksum=FD99 ok"},
+		{name: "Response", data: "~200146000000FDB3\r", want: "ver=20 adr=01 cid1=46 cid2=00 length=0 ok chksum=FDB3 ok"},
+		{name: "Bad checksum", data: "~200146000000FDB4\r", want: "ver=20 adr=01 cid1=46 cid2=00 length=0 ok chksum=FDB4 mismatch, expected FDB3"},
+		{name: "Bad length", data: "~20014642F002FFFD09\r", want: "ver=20 adr=01 cid1=46 cid2=42 (getBatteryStatus) length=F002 mismatch, expected E002 chksum=FD09 ok"},
+		{name: "Incomplete", data: "~2001", want: "incomplete frame"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DescribeFrame([]byte(tt.data)); got != tt.want {
+				t.Errorf("DescribeFrame() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}